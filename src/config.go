@@ -0,0 +1,96 @@
+package fzf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// scanConfigOptions reads --config and --profile options at the front of the
+// words so that the configuration file can be loaded before the other options
+// are processed. It returns the number of the words consumed. The options are
+// not looked for after the front as the words can be the values of the other
+// options. (e.g. --query --profile)
+func scanConfigOptions(words []string, file *string, profile *string) int {
+	i := 0
+	for ; i < len(words); i++ {
+		arg := words[i]
+		switch arg {
+		case "--config":
+			*file = nextString(words, &i, "configuration file path required")
+		case "--profile":
+			*profile = nextString(words, &i, "profile name required")
+		default:
+			if match, value := optString(arg, "--config="); match {
+				*file = value
+			} else if match, value := optString(arg, "--profile="); match {
+				*profile = value
+			} else {
+				return i
+			}
+		}
+	}
+	return i
+}
+
+// readConfig reads the configuration file and returns the options for the
+// global section followed by the options for the profile
+func readConfig(path string, profile string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New("configuration file not found: " + path)
+		}
+		return nil, errors.New("failed to read configuration file: " + err.Error())
+	}
+	return parseConfig(string(data), profile)
+}
+
+// parseConfig parses the content of the configuration file. Each line holds
+// options in the same format as $FZF_DEFAULT_OPTS, usually one option per
+// line. Blank lines and lines starting with # are ignored. A line of
+// [NAME] starts the section of a profile, which is applied only when the
+// profile is selected.
+func parseConfig(data string, profile string) ([]string, error) {
+	global := []string{}
+	profiles := make(map[string][]string)
+	section := ""
+	for idx, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if len(section) == 0 {
+				return nil, errors.New("empty profile name on line " + strconv.Itoa(idx+1))
+			}
+			if _, found := profiles[section]; !found {
+				profiles[section] = []string{}
+			}
+			continue
+		}
+		words, err := shellwords.Parse(line)
+		if err != nil {
+			return nil, errors.New("invalid configuration on line " + strconv.Itoa(idx+1) + ": " + line)
+		}
+		if len(section) > 0 {
+			profiles[section] = append(profiles[section], words...)
+		} else {
+			global = append(global, words...)
+		}
+	}
+
+	if len(profile) == 0 {
+		return global, nil
+	}
+	words, found := profiles[profile]
+	if !found {
+		return nil, errors.New("profile not found: " + profile)
+	}
+	return append(global, words...), nil
+}
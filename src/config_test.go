@@ -0,0 +1,67 @@
+package fzf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	data := `
+# Global options
+--height=40%
+--bind 'ctrl-a:select-all,ctrl-d:deselect-all'
+
+[git-log]
+  --no-sort
+--preview "git show --color=always {1}"
+
+[empty]
+[files]
+--multi
+`
+	check := func(profile string, expected ...string) {
+		words, err := parseConfig(data, profile)
+		if err != nil {
+			t.Errorf("%s: %v", profile, err)
+		} else if strings.Join(words, "|") != strings.Join(expected, "|") {
+			t.Errorf("%s: %q", profile, words)
+		}
+	}
+	global := []string{"--height=40%", "--bind", "ctrl-a:select-all,ctrl-d:deselect-all"}
+	check("", global...)
+	check("git-log", append(global, "--no-sort", "--preview", "git show --color=always {1}")...)
+	check("empty", global...)
+	check("files", append(global, "--multi")...)
+
+	if _, err := parseConfig(data, "nope"); err == nil {
+		t.Error("unknown profile should fail")
+	}
+	if _, err := parseConfig("--bind 'ctrl-a:abort", ""); err == nil {
+		t.Error("unterminated quote should fail")
+	}
+}
+
+func TestScanConfigOptions(t *testing.T) {
+	file, profile := "default", ""
+	words := []string{"--config", "foo", "--profile=bar", "--config=baz", "-m", "--profile", "qux"}
+	if n := scanConfigOptions(words, &file, &profile); n != 4 {
+		t.Errorf("%d", n)
+	}
+	if file != "baz" || profile != "bar" {
+		t.Errorf("%s, %s", file, profile)
+	}
+
+	// Values of the other options are not taken as the options
+	file, profile = "", ""
+	if n := scanConfigOptions([]string{"--query", "--profile", "foo"}, &file, &profile); n != 0 {
+		t.Errorf("%d", n)
+	}
+	if file != "" || profile != "" {
+		t.Errorf("%s, %s", file, profile)
+	}
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--query", "--profile", "-m"})
+	if opts.Query != "--profile" || !opts.Multi {
+		t.Errorf("%s, %v", opts.Query, opts.Multi)
+	}
+}
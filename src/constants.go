@@ -25,6 +25,7 @@ const (
 	initialDelay    = 20 * time.Millisecond
 	initialDelayTac = 100 * time.Millisecond
 	spinnerDuration = 200 * time.Millisecond
+	failureDuration = 3 * time.Second
 
 	// Matcher
 	numPartitionsMultiplier = 8
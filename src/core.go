@@ -56,6 +56,13 @@ func Run(opts *Options, revision string) {
 		os.Exit(exitOk)
 	}
 
+	if opts.ListThemes {
+		for _, name := range listThemes() {
+			fmt.Println(name)
+		}
+		os.Exit(exitOk)
+	}
+
 	// Event channel
 	eventBox := util.NewEventBox()
 
@@ -142,6 +149,15 @@ func Run(opts *Options, revision string) {
 	}
 	matcher := NewMatcher(patternBuilder, sort, opts.Tac, eventBox)
 
+	// Prints the item in the format of --output-format
+	printItem := func(query string, index int, item *Item) {
+		if len(opts.OutputFmt) > 0 {
+			opts.Printer(formatOutput(opts.OutputFmt, opts.Ansi, opts.Delimiter, query, "", index, item))
+		} else {
+			opts.Printer(item.AsString(opts.Ansi))
+		}
+	}
+
 	// Filtering mode
 	if opts.Filter != nil {
 		if opts.PrintQuery {
@@ -151,6 +167,7 @@ func Run(opts *Options, revision string) {
 		pattern := patternBuilder([]rune(*opts.Filter))
 
 		found := false
+		count := 0
 		if streamingFilter {
 			slab := util.MakeSlab(slab16Size, slab32Size)
 			reader := NewReader(
@@ -158,8 +175,13 @@ func Run(opts *Options, revision string) {
 					item := Item{}
 					if chunkList.trans(&item, runes) {
 						if result, _, _ := pattern.MatchItem(&item, false, slab); result != nil {
-							opts.Printer(item.text.ToString())
+							if len(opts.OutputFmt) > 0 {
+								printItem(*opts.Filter, count, &item)
+							} else {
+								opts.Printer(item.text.ToString())
+							}
 							found = true
+							count++
 						}
 					}
 					return false
@@ -174,7 +196,7 @@ func Run(opts *Options, revision string) {
 				chunks:  snapshot,
 				pattern: pattern})
 			for i := 0; i < merger.Length(); i++ {
-				opts.Printer(merger.Get(i).item.AsString(opts.Ansi))
+				printItem(*opts.Filter, i, merger.Get(i).item)
 				found = true
 			}
 		}
@@ -195,6 +217,7 @@ func Run(opts *Options, revision string) {
 
 	// Terminal I/O
 	terminal := NewTerminal(opts, eventBox)
+	terminal.patternBuilder = patternBuilder
 	deferred := opts.Select1 || opts.Exit0
 	go terminal.Loop()
 	if !deferred {
@@ -219,6 +242,9 @@ func Run(opts *Options, revision string) {
 					reading = reading && evt == EvtReadNew
 					snapshot, count := chunkList.Snapshot()
 					terminal.UpdateCount(count, !reading, value.(bool))
+					if opts.Session != nil {
+						terminal.RestoreSession(snapshot)
+					}
 					if opts.Sync {
 						terminal.UpdateList(PassMerger(&snapshot, opts.Tac))
 					}
@@ -259,7 +285,7 @@ func Run(opts *Options, revision string) {
 										opts.Printer("")
 									}
 									for i := 0; i < count; i++ {
-										opts.Printer(val.Get(i).item.AsString(opts.Ansi))
+										printItem(opts.Query, i, val.Get(i).item)
 									}
 									if count > 0 {
 										os.Exit(exitOk)
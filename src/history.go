@@ -4,12 +4,60 @@ import (
 	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/junegunn/fzf/src/util"
 )
 
+// historyEntry is a query in the history file with the time it was added and
+// the key of the context it was made in
+type historyEntry struct {
+	time  int64
+	key   string
+	query string
+}
+
+// encode returns the line for the entry in the history file. The key and the
+// query are quoted so that multi-line queries can be stored in a line.
+func (e historyEntry) encode() string {
+	return strconv.FormatInt(e.time, 10) + "\t" + strconv.Quote(e.key) + "\t" + strconv.Quote(e.query)
+}
+
+// decodeHistoryEntry parses the line in the history file. A line that is not
+// in the format of encode is a query written by the older versions of fzf.
+func decodeHistoryEntry(line string) historyEntry {
+	tokens := strings.SplitN(line, "\t", 3)
+	if len(tokens) == 3 {
+		ts, err1 := strconv.ParseInt(tokens[0], 10, 64)
+		key, err2 := strconv.Unquote(tokens[1])
+		query, err3 := strconv.Unquote(tokens[2])
+		if err1 == nil && err2 == nil && err3 == nil {
+			return historyEntry{ts, key, query}
+		}
+	}
+	return historyEntry{0, "", line}
+}
+
+// decodeHistory returns the entries in the content of the history file
+func decodeHistory(data []byte) []historyEntry {
+	entries := []historyEntry{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) > 0 {
+			entries = append(entries, decodeHistoryEntry(line))
+		}
+	}
+	return entries
+}
+
 // History struct represents input history
 type History struct {
 	path     string
+	lock     *os.File
+	key      string
+	entries  []historyEntry
 	lines    []string
 	modified map[int]string
 	maxSize  int
@@ -38,17 +86,61 @@ func NewHistory(path string, maxSize int) (*History, error) {
 			return nil, fmtError(err)
 		}
 	}
-	// Split lines and limit the maximum number of lines
-	lines := strings.Split(strings.Trim(string(data), "\n"), "\n")
-	if len(lines[len(lines)-1]) > 0 {
-		lines = append(lines, "")
+	// The lock file is kept next to the history file for synchronizing the
+	// updates of the processes sharing the file
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmtError(err)
 	}
-	return &History{
+	entries := decodeHistory(data)
+	h := &History{
 		path:     path,
+		lock:     lock,
 		maxSize:  maxSize,
-		lines:    lines,
-		modified: make(map[int]string),
-		cursor:   len(lines) - 1}, nil
+		entries:  entries,
+		modified: make(map[int]string)}
+	h.load()
+	return h, nil
+}
+
+// visible returns true if the entry should be shown in the current context.
+// Entries without a key are shared by all contexts.
+func (h *History) visible(entry historyEntry) bool {
+	return len(h.key) == 0 || len(entry.key) == 0 || entry.key == h.key
+}
+
+// load builds the list of queries for the navigation from the entries
+func (h *History) load() {
+	lines := []string{}
+	for _, entry := range h.entries {
+		if h.visible(entry) {
+			lines = append(lines, entry.query)
+		}
+	}
+	h.lines = append(lines, "")
+	h.modified = make(map[int]string)
+	h.cursor = len(h.lines) - 1
+}
+
+// setKey sets the key of the context of the new entries. Only the entries of
+// the context are available for the navigation.
+func (h *History) setKey(key string) {
+	h.key = key
+	h.load()
+}
+
+// queries returns the unique queries of the context, the most recent first
+func (h *History) queries() []string {
+	found := make(map[string]bool)
+	queries := []string{}
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		entry := h.entries[i]
+		if h.visible(entry) && !found[entry.query] {
+			found[entry.query] = true
+			queries = append(queries, entry.query)
+		}
+	}
+	return queries
 }
 
 func (h *History) append(line string) error {
@@ -57,12 +149,63 @@ func (h *History) append(line string) error {
 		return nil
 	}
 
-	lines := append(h.lines[:len(h.lines)-1], line)
-	if len(lines) > h.maxSize {
-		lines = lines[len(lines)-h.maxSize : len(lines)]
+	// Other fzf processes may have updated the file since we read it
+	if err := util.LockFile(h.lock); err != nil {
+		return err
 	}
-	h.lines = append(lines, "")
-	return ioutil.WriteFile(h.path, []byte(strings.Join(h.lines, "\n")), 0600)
+	defer util.UnlockFile(h.lock)
+
+	data, err := ioutil.ReadFile(h.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	entries := mergeHistory(decodeHistory(data), historyEntry{time.Now().Unix(), h.key, line})
+	if len(entries) > h.maxSize {
+		entries = entries[len(entries)-h.maxSize:]
+	}
+	h.entries = entries
+	h.load()
+
+	lines := make([]string, len(entries))
+	for idx, entry := range entries {
+		lines[idx] = entry.encode()
+	}
+	return writeFileAtomic(h.path, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// mergeHistory appends the new entry to the entries. The older entries with
+// the same key and query are removed.
+func mergeHistory(entries []historyEntry, entry historyEntry) []historyEntry {
+	merged := make([]historyEntry, 0, len(entries)+1)
+	for _, e := range entries {
+		if e.key != entry.key || e.query != entry.query {
+			merged = append(merged, e)
+		}
+	}
+	return append(merged, entry)
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory
+// and renames it to the path, so that the file is never left half-written
+func writeFileAtomic(path string, data []byte) error {
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
 }
 
 func (h *History) override(str string) {
@@ -4,7 +4,11 @@ import (
 	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -32,11 +36,15 @@ func TestHistory(t *testing.T) {
 
 	f, _ := ioutil.TempFile("", "fzf-history")
 	f.Close()
+	defer os.Remove(f.Name() + ".lock")
 
 	{ // Append lines
 		h, _ := NewHistory(f.Name(), maxHistory)
+		if _, err := os.Stat(f.Name() + ".lock"); err != nil {
+			t.Error("lock file should be created with the history file")
+		}
 		for i := 0; i < maxHistory+10; i++ {
-			h.append("foobar")
+			h.append("foobar" + strconv.Itoa(i))
 		}
 	}
 	{ // Read lines
@@ -45,8 +53,8 @@ func TestHistory(t *testing.T) {
 			t.Errorf("Expected: %d, actual: %d\n", maxHistory+1, len(h.lines))
 		}
 		for i := 0; i < maxHistory; i++ {
-			if h.lines[i] != "foobar" {
-				t.Error("Expected: foobar, actual: " + h.lines[i])
+			if exp := "foobar" + strconv.Itoa(i+10); h.lines[i] != exp {
+				t.Error("Expected: " + exp + ", actual: " + h.lines[i])
 			}
 		}
 	}
@@ -66,8 +74,102 @@ func TestHistory(t *testing.T) {
 				t.Errorf("Expected: %s, actual: %s\n", exp, h.lines[idx])
 			}
 		}
-		compare(maxHistory-3, "foobar")
+		compare(maxHistory-3, "foobar"+strconv.Itoa(maxHistory+9))
 		compare(maxHistory-2, "barfoo")
 		compare(maxHistory-1, "foobarbaz")
 	}
 }
+
+func TestHistoryEntries(t *testing.T) {
+	f, _ := ioutil.TempFile("", "fzf-history")
+	// Written by the older versions of fzf
+	f.WriteString("foo\nbar\n")
+	f.Close()
+	defer os.Remove(f.Name())
+	defer os.Remove(f.Name() + ".lock")
+
+	{
+		h, _ := NewHistory(f.Name(), 10)
+		h.setKey("files")
+		h.append("multi\nline")
+		h.append("nul\x00\"quoted\"\t")
+	}
+	{
+		h, _ := NewHistory(f.Name(), 10)
+		h.setKey("dirs")
+		h.append("baz")
+		h.append("foo")
+	}
+
+	h, _ := NewHistory(f.Name(), 10)
+	if len(h.entries) != 6 || h.entries[2].key != "files" || h.entries[2].time == 0 {
+		t.Errorf("invalid entries: %v", h.entries)
+	}
+	expected := []string{"foo", "bar", "multi\nline", "nul\x00\"quoted\"\t", "baz", "foo", ""}
+	if strings.Join(h.lines, "|") != strings.Join(expected, "|") {
+		t.Errorf("invalid lines: %q", h.lines)
+	}
+
+	// Entries without a key are visible in every context
+	h.setKey("files")
+	if h.previous() != "nul\x00\"quoted\"\t" || h.previous() != "multi\nline" || h.previous() != "bar" {
+		t.Error("invalid navigation")
+	}
+	h.setKey("dirs")
+	if queries := h.queries(); strings.Join(queries, "|") != "foo|baz|bar" {
+		t.Errorf("invalid queries: %q", queries)
+	}
+}
+
+func TestHistoryConcurrentWriters(t *testing.T) {
+	f, _ := ioutil.TempFile("", "fzf-history")
+	f.WriteString("dup\n")
+	f.Close()
+	defer os.Remove(f.Name())
+	defer os.Remove(f.Name() + ".lock")
+
+	// Every writer loads the file before the others write to it
+	writers, appends := 8, 20
+	histories := make([]*History, writers)
+	for i := range histories {
+		histories[i], _ = NewHistory(f.Name(), 1000)
+	}
+	var wg sync.WaitGroup
+	for i, h := range histories {
+		wg.Add(1)
+		go func(i int, h *History) {
+			defer wg.Done()
+			for j := 0; j < appends; j++ {
+				if err := h.append(strconv.Itoa(i) + "-" + strconv.Itoa(j)); err != nil {
+					t.Error(err)
+				}
+				h.append("dup")
+			}
+		}(i, h)
+	}
+	wg.Wait()
+
+	h, _ := NewHistory(f.Name(), 1000)
+	found := make(map[string]int)
+	for _, entry := range h.entries {
+		found[entry.query]++
+	}
+	if len(h.entries) != writers*appends+1 || found["dup"] != 1 {
+		t.Errorf("expected %d entries, got %d (dup: %d)", writers*appends+1, len(h.entries), found["dup"])
+	}
+	for i := 0; i < writers; i++ {
+		for j := 0; j < appends; j++ {
+			if found[strconv.Itoa(i)+"-"+strconv.Itoa(j)] != 1 {
+				t.Errorf("missing entry: %d-%d", i, j)
+			}
+		}
+	}
+
+	// No temporary files are left behind
+	files, _ := ioutil.ReadDir(filepath.Dir(f.Name()))
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), "."+filepath.Base(f.Name())) {
+			t.Errorf("temporary file left: %s", file.Name())
+		}
+	}
+}
@@ -85,6 +85,55 @@ func (mg *Merger) Get(idx int) Result {
 	panic(fmt.Sprintf("Index out of bounds (unsorted, %d/%d)", idx, mg.count))
 }
 
+// FindIndex returns the position of the item with the given index in the
+// list, or -1 if the item is not in the list
+func (mg *Merger) FindIndex(itemIndex int32) int {
+	if mg.chunks != nil {
+		index := int(itemIndex)
+		if index < 0 || index >= mg.count {
+			return -1
+		}
+		if mg.tac {
+			index = mg.count - index - 1
+		}
+		return index
+	}
+	for i := 0; i < mg.count; i++ {
+		if mg.Get(i).item.Index() == itemIndex {
+			return i
+		}
+	}
+	return -1
+}
+
+// newestIndex returns the index of the most recent item in the unsorted list,
+// or -1 if the list is empty
+func (mg *Merger) newestIndex() int32 {
+	if mg.count == 0 {
+		return -1
+	}
+	if mg.tac {
+		return mg.Get(0).item.Index()
+	}
+	return mg.Get(mg.count - 1).item.Index()
+}
+
+// countNewer returns the number of items in the unsorted list whose index is
+// equal to or greater than the given index
+func (mg *Merger) countNewer(itemIndex int32) int {
+	count := 0
+	for ; count < mg.count; count++ {
+		idx := count
+		if !mg.tac {
+			idx = mg.count - count - 1
+		}
+		if mg.Get(idx).item.Index() < itemIndex {
+			break
+		}
+	}
+	return count
+}
+
 func (mg *Merger) cacheable() bool {
 	return mg.count < mergerCacheMax
 }
@@ -86,3 +86,40 @@ func TestMergerSorted(t *testing.T) {
 		}
 	}
 }
+
+func TestMergerFindIndex(t *testing.T) {
+	lists, items := buildLists(false)
+	for i := range items {
+		items[i].item.text.Index = int32(i)
+	}
+	mg := NewMerger(nil, lists, false, false)
+	for i := range items {
+		assert(t, mg.FindIndex(int32(i)) == i, "Invalid FindIndex")
+	}
+	assert(t, mg.FindIndex(int32(len(items))) == -1, "Should not be found")
+
+	chunk := Chunk{count: 3}
+	for i := 0; i < chunk.count; i++ {
+		chunk.items[i].text.Index = int32(i)
+	}
+	chunks := []*Chunk{&chunk}
+	assert(t, PassMerger(&chunks, false).FindIndex(1) == 1, "Invalid FindIndex")
+	assert(t, PassMerger(&chunks, true).FindIndex(0) == 2, "Invalid FindIndex (tac)")
+	assert(t, PassMerger(&chunks, true).FindIndex(3) == -1, "Should not be found")
+}
+
+func TestMergerNewest(t *testing.T) {
+	chunk := Chunk{count: 5}
+	for i := 0; i < chunk.count; i++ {
+		chunk.items[i].text.Index = int32(i)
+	}
+	chunks := []*Chunk{&chunk}
+	for _, tac := range []bool{false, true} {
+		mg := PassMerger(&chunks, tac)
+		assert(t, mg.newestIndex() == 4, "Invalid newestIndex")
+		assert(t, mg.countNewer(3) == 2, "Invalid countNewer")
+		assert(t, mg.countNewer(5) == 0, "Invalid countNewer")
+		assert(t, mg.countNewer(0) == 5, "Invalid countNewer")
+	}
+	assert(t, EmptyMerger.newestIndex() == -1, "Invalid newestIndex")
+}
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/junegunn/fzf/src/algo"
@@ -33,15 +34,21 @@ const usage = `usage: fzf [options]
     -d, --delimiter=STR   Field delimiter regex (default: AWK-style)
     +s, --no-sort         Do not sort the result
     --tac                 Reverse the order of the input
+    --follow              Keep the view on the newest item when the list is
+                          not sorted
     --tiebreak=CRI[,..]   Comma-separated list of sort criteria to apply
                           when the scores are tied [length|begin|end|index]
                           (default: length)
 
   Interface
     -m, --multi           Enable multi-select with tab/shift-tab
+    --max-selections=N    Maximum number of items that can be selected
     --no-mouse            Disable mouse
     --bind=KEYBINDS       Custom key bindings. Refer to the man page.
+    --keymap=KEYMAP       Query editing mode [emacs|vi] (default: emacs)
     --cycle               Enable cyclic scroll
+    --track               Keep the cursor on the current item when the list
+                          is updated
     --no-hscroll          Disable horizontal scroll
     --hscroll-off=COL     Number of screen columns to keep to the right of the
                           highlighted substring (default: 10)
@@ -53,23 +60,38 @@ const usage = `usage: fzf [options]
                           height instead of using fullscreen
     --min-height=HEIGHT   Minimum height when --height is given in percent
                           (default: 10)
-    --reverse             Reverse orientation
+    --layout=LAYOUT       Choose layout: [default|reverse|reverse-list]
+    --reverse             A synonym for --layout=reverse
     --border              Draw border above and below the finder
     --margin=MARGIN       Screen margin (TRBL / TB,RL / T,RL,B / T,R,B,L)
-    --inline-info         Display finder info inline with the query
+    --info=STYLE          Finder info style [default|inline|hidden|right]
+    --inline-info         A synonym for --info=inline
+    --separator=STR       Draw a horizontal separator on the info line
+    --scrollbar=CHAR      Scrollbar character (default: '│')
+    --no-scrollbar        Hide scrollbar
     --prompt=STR          Input prompt (default: '> ')
+    --pointer=STR         Pointer to the current line (default: '>')
+    --marker=STR          Multi-select marker (default: '>')
+    --no-gutter           Hide the pointer and marker columns
+    --line-numbers        Display the index of each item in the input
     --header=STR          String to print as header
     --header-lines=N      The first N lines of the input are treated as header
 
   Display
     --ansi                Enable processing of ANSI color codes
     --tabstop=SPACES      Number of spaces for a tab character (default: 8)
+    --tabular[=MAX]       Align the fields of the visible lines in columns,
+                          optionally truncating them to MAX columns
     --color=COLSPEC       Base scheme (dark|light|16|bw) and/or custom colors
+    --list-themes         List the available color themes and exit
     --no-bold             Do not use bold text
 
   History
     --history=FILE        History file
     --history-size=N      Maximum number of history entries (default: 1000)
+    --history-key=KEY     Only use the history entries of the given context
+    --session=FILE        Restore the query and the selection of the previous
+                          session and save them on exit
 
   Preview
     --preview=COMMAND     Command to preview highlighted line ({})
@@ -82,15 +104,25 @@ const usage = `usage: fzf [options]
     -0, --exit-0          Exit immediately when there's no match
     -f, --filter=STR      Filter mode. Do not start interactive finder.
     --print-query         Print query as the first line
+    --print-order=ORDER   Order of the selected items in the output
+                          [selection|index|score] (default: selection)
+    --output-format=TEMPLATE
+                          Format of each item in the output
+                          (e.g. '{2}', '{i}:{k}:{}')
     --expect=KEYS         Comma-separated list of keys to complete fzf
     --read0               Read input delimited by ASCII NUL characters
     --print0              Print output delimited by ASCII NUL characters
     --sync                Synchronous search for multi-staged filtering
     --version             Display version information and exit
 
+  Configuration
+    --config=FILE         Configuration file (default: $FZF_DEFAULT_OPTS_FILE)
+    --profile=NAME        Apply the options in [NAME] section of the file
+
   Environment variables
     FZF_DEFAULT_COMMAND   Default command to use when input is tty
     FZF_DEFAULT_OPTS      Default options (e.g. '--reverse --inline-info')
+    FZF_DEFAULT_OPTS_FILE Configuration file
 
 `
 
@@ -132,6 +164,38 @@ const (
 	posRight
 )
 
+type layoutType int
+
+const (
+	layoutDefault layoutType = iota
+	layoutReverse
+	layoutReverseList
+)
+
+type infoStyle int
+
+const (
+	infoDefault infoStyle = iota
+	infoInline
+	infoHidden
+	infoRight
+)
+
+type printOrder int
+
+const (
+	printOrderSelection printOrder = iota
+	printOrderIndex
+	printOrderScore
+)
+
+type keymapStyle int
+
+const (
+	keymapEmacs keymapStyle = iota
+	keymapVi
+)
+
 type previewOpts struct {
 	command  string
 	position windowPosition
@@ -152,8 +216,10 @@ type Options struct {
 	Delimiter   Delimiter
 	Sort        int
 	Tac         bool
+	Follow      bool
 	Criteria    []criterion
 	Multi       bool
+	MaxSelect   int
 	Ansi        bool
 	Mouse       bool
 	Theme       *tui.ColorTheme
@@ -161,34 +227,50 @@ type Options struct {
 	Bold        bool
 	Height      sizeSpec
 	MinHeight   int
-	Reverse     bool
+	Layout      layoutType
 	Cycle       bool
+	Track       bool
 	Hscroll     bool
 	HscrollOff  int
 	FileWord    bool
-	InlineInfo  bool
+	Info        infoStyle
+	Separator   string
+	Scrollbar   string
 	JumpLabels  string
 	Prompt      string
+	Pointer     string
+	Marker      string
+	Gutter      bool
+	LineNumbers bool
 	Query       string
 	Select1     bool
 	Exit0       bool
 	Filter      *string
 	ToggleSort  bool
-	Expect      map[int]string
-	Keymap      map[int][]action
+	Expect      map[tui.Key]string
+	Keymap      map[tui.Key][]action
+	Sequences   []keySequence
+	KeymapStyle keymapStyle
 	Preview     previewOpts
 	PrintQuery  bool
+	PrintOrder  printOrder
+	OutputFmt   string
 	ReadZero    bool
 	Printer     func(string)
 	Sync        bool
 	History     *History
+	HistoryKey  string
+	Session     *Session
 	Header      []string
 	HeaderLines int
 	Margin      [4]sizeSpec
 	Bordered    bool
 	Tabstop     int
+	Tabular     bool
+	TabularMax  int
 	ClearOnExit bool
 	Version     bool
+	ListThemes  bool
 }
 
 func defaultOptions() *Options {
@@ -203,41 +285,59 @@ func defaultOptions() *Options {
 		Delimiter:   Delimiter{},
 		Sort:        1000,
 		Tac:         false,
+		Follow:      false,
 		Criteria:    []criterion{byScore, byLength},
 		Multi:       false,
+		MaxSelect:   0,
 		Ansi:        false,
 		Mouse:       true,
 		Theme:       tui.EmptyTheme(),
 		Black:       false,
 		Bold:        true,
 		MinHeight:   10,
-		Reverse:     false,
+		Layout:      layoutDefault,
 		Cycle:       false,
+		Track:       false,
 		Hscroll:     true,
 		HscrollOff:  10,
 		FileWord:    false,
-		InlineInfo:  false,
+		Info:        infoDefault,
+		Separator:   "",
+		Scrollbar:   "│",
 		JumpLabels:  defaultJumpLabels,
 		Prompt:      "> ",
+		Pointer:     ">",
+		Marker:      ">",
+		Gutter:      true,
+		LineNumbers: false,
 		Query:       "",
 		Select1:     false,
 		Exit0:       false,
 		Filter:      nil,
 		ToggleSort:  false,
-		Expect:      make(map[int]string),
-		Keymap:      make(map[int][]action),
+		Expect:      make(map[tui.Key]string),
+		Keymap:      make(map[tui.Key][]action),
+		Sequences:   []keySequence{},
+		KeymapStyle: keymapEmacs,
 		Preview:     previewOpts{"", posRight, sizeSpec{50, true}, false, false},
 		PrintQuery:  false,
+		PrintOrder:  printOrderSelection,
+		OutputFmt:   "",
 		ReadZero:    false,
 		Printer:     func(str string) { fmt.Println(str) },
 		Sync:        false,
 		History:     nil,
+		HistoryKey:  "",
+		Session:     nil,
 		Header:      make([]string, 0),
 		HeaderLines: 0,
 		Margin:      defaultMargin(),
 		Tabstop:     8,
+		Tabular:     false,
+		TabularMax:  0,
 		ClearOnExit: true,
-		Version:     false}
+		Version:     false,
+		ListThemes:  false}
 }
 
 func help(code int) {
@@ -350,10 +450,6 @@ func isAlphabet(char uint8) bool {
 	return char >= 'a' && char <= 'z'
 }
 
-func isNumeric(char uint8) bool {
-	return char >= '0' && char <= '9'
-}
-
 func parseAlgo(str string) algo.Algo {
 	switch str {
 	case "v1":
@@ -366,7 +462,7 @@ func parseAlgo(str string) algo.Algo {
 	return algo.FuzzyMatchV2
 }
 
-func parseKeyChords(str string, message string) map[int]string {
+func parseKeyChords(str string, message string) map[tui.Key]string {
 	if len(str) == 0 {
 		errorExit(message)
 	}
@@ -376,94 +472,105 @@ func parseKeyChords(str string, message string) map[int]string {
 		tokens = append(tokens, ",")
 	}
 
-	chords := make(map[int]string)
+	chords := make(map[tui.Key]string)
 	for _, key := range tokens {
 		if len(key) == 0 {
 			continue // ignore
 		}
-		lkey := strings.ToLower(key)
-		chord := 0
-		switch lkey {
-		case "up":
-			chord = tui.Up
-		case "down":
-			chord = tui.Down
-		case "left":
-			chord = tui.Left
-		case "right":
-			chord = tui.Right
-		case "enter", "return":
-			chord = tui.CtrlM
-		case "space":
-			chord = tui.AltZ + int(' ')
-		case "bspace", "bs":
-			chord = tui.BSpace
-		case "ctrl-space":
-			chord = tui.CtrlSpace
-		case "change":
-			chord = tui.Change
-		case "alt-enter", "alt-return":
-			chord = tui.CtrlAltM
-		case "alt-space":
-			chord = tui.AltSpace
-		case "alt-/":
-			chord = tui.AltSlash
-		case "alt-bs", "alt-bspace":
-			chord = tui.AltBS
-		case "tab":
-			chord = tui.Tab
-		case "btab", "shift-tab":
-			chord = tui.BTab
-		case "esc":
-			chord = tui.ESC
-		case "del":
-			chord = tui.Del
-		case "home":
-			chord = tui.Home
-		case "end":
-			chord = tui.End
-		case "pgup", "page-up":
-			chord = tui.PgUp
-		case "pgdn", "page-down":
-			chord = tui.PgDn
-		case "shift-left":
-			chord = tui.SLeft
-		case "shift-right":
-			chord = tui.SRight
-		case "left-click":
-			chord = tui.LeftClick
-		case "right-click":
-			chord = tui.RightClick
-		case "double-click":
-			chord = tui.DoubleClick
-		case "f10":
-			chord = tui.F10
-		case "f11":
-			chord = tui.F11
-		case "f12":
-			chord = tui.F12
-		default:
-			if len(key) == 10 && strings.HasPrefix(lkey, "ctrl-alt-") && isAlphabet(lkey[9]) {
-				chord = tui.CtrlAltA + int(lkey[9]) - 'a'
-			} else if len(key) == 6 && strings.HasPrefix(lkey, "ctrl-") && isAlphabet(lkey[5]) {
-				chord = tui.CtrlA + int(lkey[5]) - 'a'
-			} else if len(key) == 5 && strings.HasPrefix(lkey, "alt-") && isAlphabet(lkey[4]) {
-				chord = tui.AltA + int(lkey[4]) - 'a'
-			} else if len(key) == 5 && strings.HasPrefix(lkey, "alt-") && isNumeric(lkey[4]) {
-				chord = tui.Alt0 + int(lkey[4]) - '0'
-			} else if len(key) == 2 && strings.HasPrefix(lkey, "f") && key[1] >= '1' && key[1] <= '9' {
-				chord = tui.F1 + int(key[1]) - '1'
-			} else if utf8.RuneCountInString(key) == 1 {
-				chord = tui.AltZ + int([]rune(key)[0])
-			} else {
-				errorExit("unsupported key: " + key)
+		chords[parseKeyChord(key)] = key
+	}
+	return chords
+}
+
+var keyNames = map[string]int{
+	"up":        tui.Up,
+	"down":      tui.Down,
+	"left":      tui.Left,
+	"right":     tui.Right,
+	"enter":     tui.CtrlM,
+	"return":    tui.CtrlM,
+	"bspace":    tui.BSpace,
+	"bs":        tui.BSpace,
+	"tab":       tui.Tab,
+	"btab":      tui.BTab,
+	"esc":       tui.ESC,
+	"del":       tui.Del,
+	"insert":    tui.Insert,
+	"home":      tui.Home,
+	"end":       tui.End,
+	"pgup":      tui.PgUp,
+	"page-up":   tui.PgUp,
+	"pgdn":      tui.PgDn,
+	"page-down": tui.PgDn,
+	"f1":        tui.F1,
+	"f2":        tui.F2,
+	"f3":        tui.F3,
+	"f4":        tui.F4,
+	"f5":        tui.F5,
+	"f6":        tui.F6,
+	"f7":        tui.F7,
+	"f8":        tui.F8,
+	"f9":        tui.F9,
+	"f10":       tui.F10,
+	"f11":       tui.F11,
+	"f12":       tui.F12,
+}
+
+var modifierNames = []struct {
+	prefix string
+	mod    tui.Modifier
+}{
+	{"ctrl-", tui.ModCtrl},
+	{"alt-", tui.ModAlt},
+	{"shift-", tui.ModShift},
+}
+
+// parseKeyChord parses a key name with optional modifier prefixes, such as
+// ctrl-alt-up, and returns the key in the form the renderers report it
+func parseKeyChord(key string) tui.Key {
+	lkey := strings.ToLower(key)
+	switch lkey {
+	case "change":
+		return tui.KeyOf(tui.Change)
+	case "left-click":
+		return tui.KeyOf(tui.LeftClick)
+	case "right-click":
+		return tui.KeyOf(tui.RightClick)
+	case "double-click":
+		return tui.KeyOf(tui.DoubleClick)
+	}
+
+	base := key
+	mod := tui.Modifier(0)
+Prefix:
+	for {
+		lbase := strings.ToLower(base)
+		for _, m := range modifierNames {
+			if len(base) > len(m.prefix) && strings.HasPrefix(lbase, m.prefix) {
+				mod |= m.mod
+				base = base[len(m.prefix):]
+				continue Prefix
 			}
 		}
-		if chord > 0 {
-			chords[chord] = key
+		break
+	}
+
+	chord := tui.Key{}
+	if keyType, prs := keyNames[strings.ToLower(base)]; prs {
+		chord = tui.KeyOf(keyType)
+	} else if strings.ToLower(base) == "space" {
+		chord = tui.RuneKey(' ', 0)
+	} else if utf8.RuneCountInString(base) == 1 {
+		char := []rune(base)[0]
+		if mod != 0 {
+			char = unicode.ToLower(char)
 		}
+		chord = tui.RuneKey(char, 0)
+	} else {
+		errorExit("unsupported key: " + key)
 	}
-	return chords
+
+	return tui.WithModifiers(chord, mod)
 }
 
 func parseTiebreak(str string) []criterion {
@@ -509,10 +616,31 @@ func dupeTheme(theme *tui.ColorTheme) *tui.ColorTheme {
 	return nil
 }
 
+func addAttr(attr tui.Attr, other tui.Attr) tui.Attr {
+	if attr == tui.AttrUndefined {
+		return other
+	}
+	return attr.Merge(other)
+}
+
 func parseTheme(defaultTheme *tui.ColorTheme, str string) *tui.ColorTheme {
 	theme := dupeTheme(defaultTheme)
 	rrggbb := regexp.MustCompile("^#[0-9a-fA-F]{6}$")
-	for _, str := range strings.Split(strings.ToLower(str), ",") {
+	for _, str := range strings.Split(str, ",") {
+		if strings.HasPrefix(strings.ToLower(str), "theme:") {
+			// Theme name is case-sensitive
+			name := str[len("theme:"):]
+			spec, err := readTheme(name)
+			if err != nil {
+				errorExit(err.Error())
+			}
+			if strings.Contains(strings.ToLower(spec), "theme:") {
+				errorExit("theme file cannot load another theme: " + name)
+			}
+			theme = parseTheme(theme, spec)
+			continue
+		}
+		str = strings.ToLower(str)
 		switch str {
 		case "dark":
 			theme = dupeTheme(tui.Dark256)
@@ -531,51 +659,96 @@ func parseTheme(defaultTheme *tui.ColorTheme, str string) *tui.ColorTheme {
 				continue
 			}
 
-			pair := strings.Split(str, ":")
-			if len(pair) != 2 {
+			components := strings.Split(str, ":")
+			if len(components) < 2 {
 				fail()
 			}
 
-			var ansi tui.Color
-			if rrggbb.MatchString(pair[1]) {
-				ansi = tui.HexToColor(pair[1])
-			} else {
-				ansi32, err := strconv.Atoi(pair[1])
-				if err != nil || ansi32 < -1 || ansi32 > 255 {
-					fail()
-				}
-				ansi = tui.Color(ansi32)
-			}
-			switch pair[0] {
+			var cattr *tui.ColorAttr
+			switch components[0] {
 			case "fg":
-				theme.Fg = ansi
+				cattr = &theme.Fg
 			case "bg":
-				theme.Bg = ansi
+				cattr = &theme.Bg
+			case "preview-fg":
+				cattr = &theme.PreviewFg
+			case "preview-bg":
+				cattr = &theme.PreviewBg
 			case "fg+":
-				theme.Current = ansi
+				cattr = &theme.Current
 			case "bg+":
-				theme.DarkBg = ansi
+				cattr = &theme.DarkBg
 			case "hl":
-				theme.Match = ansi
+				cattr = &theme.Match
 			case "hl+":
-				theme.CurrentMatch = ansi
+				cattr = &theme.CurrentMatch
+			case "query":
+				cattr = &theme.Query
+			case "disabled":
+				cattr = &theme.Disabled
+			case "gutter":
+				cattr = &theme.Gutter
 			case "border":
-				theme.Border = ansi
+				cattr = &theme.Border
+			case "preview-border":
+				cattr = &theme.PreviewBorder
+			case "error":
+				cattr = &theme.Error
+			case "separator":
+				cattr = &theme.Separator
 			case "prompt":
-				theme.Prompt = ansi
+				cattr = &theme.Prompt
 			case "spinner":
-				theme.Spinner = ansi
+				cattr = &theme.Spinner
 			case "info":
-				theme.Info = ansi
+				cattr = &theme.Info
 			case "pointer":
-				theme.Cursor = ansi
+				cattr = &theme.Cursor
 			case "marker":
-				theme.Selected = ansi
+				cattr = &theme.Selected
 			case "header":
-				theme.Header = ansi
+				cattr = &theme.Header
+			case "scrollbar":
+				cattr = &theme.Scrollbar
 			default:
 				fail()
 			}
+
+			// Attributes given in the specification replace the existing ones
+			attr := tui.AttrUndefined
+			for _, component := range components[1:] {
+				switch component {
+				case "regular":
+					attr = tui.AttrRegular
+				case "bold":
+					attr = addAttr(attr, tui.Bold)
+				case "dim":
+					attr = addAttr(attr, tui.Dim)
+				case "italic":
+					attr = addAttr(attr, tui.Italic)
+				case "underline":
+					attr = addAttr(attr, tui.Underline)
+				case "blink":
+					attr = addAttr(attr, tui.Blink)
+				case "reverse":
+					attr = addAttr(attr, tui.Reverse)
+				case "strikethrough":
+					attr = addAttr(attr, tui.StrikeThrough)
+				default:
+					if rrggbb.MatchString(component) {
+						cattr.Color = tui.HexToColor(component)
+					} else {
+						ansi32, err := strconv.Atoi(component)
+						if err != nil || ansi32 < -1 || ansi32 > 255 {
+							fail()
+						}
+						cattr.Color = tui.Color(ansi32)
+					}
+				}
+			}
+			if attr != tui.AttrUndefined {
+				cattr.Attr = attr
+			}
 		}
 	}
 	return theme
@@ -583,11 +756,11 @@ func parseTheme(defaultTheme *tui.ColorTheme, str string) *tui.ColorTheme {
 
 var executeRegexp *regexp.Regexp
 
-func firstKey(keymap map[int]string) int {
+func firstKey(keymap map[tui.Key]string) tui.Key {
 	for k := range keymap {
 		return k
 	}
-	return 0
+	return tui.Key{}
 }
 
 const (
@@ -600,20 +773,26 @@ func init() {
 	// Backreferences are not supported.
 	// "~!@#$%^&*;/|".each_char.map { |c| Regexp.escape(c) }.map { |c| "#{c}[^#{c}]*#{c}" }.join('|')
 	executeRegexp = regexp.MustCompile(
-		"(?si):(execute(?:-multi|-silent)?):.+|:(execute(?:-multi|-silent)?)(\\([^)]*\\)|\\[[^\\]]*\\]|~[^~]*~|![^!]*!|@[^@]*@|\\#[^\\#]*\\#|\\$[^\\$]*\\$|%[^%]*%|\\^[^\\^]*\\^|&[^&]*&|\\*[^\\*]*\\*|;[^;]*;|/[^/]*/|\\|[^\\|]*\\|)")
+		"(?si):(execute(?:-multi|-silent)?|select-matching):.+|:(execute(?:-multi|-silent)?|select-matching)(\\([^)]*\\)|\\[[^\\]]*\\]|~[^~]*~|![^!]*!|@[^@]*@|\\#[^\\#]*\\#|\\$[^\\$]*\\$|%[^%]*%|\\^[^\\^]*\\^|&[^&]*&|\\*[^\\*]*\\*|;[^;]*;|/[^/]*/|\\|[^\\|]*\\|)")
 }
 
-func parseKeymap(keymap map[int][]action, str string) {
-	masked := executeRegexp.ReplaceAllStringFunc(str, func(src string) string {
-		prefix := ":execute"
-		if src[len(prefix)] == '-' {
-			c := src[len(prefix)+1]
-			if c == 's' || c == 'S' {
-				prefix += "-silent"
-			} else {
-				prefix += "-multi"
-			}
+// parseKeySequence parses space-separated key names
+func parseKeySequence(names []string) []tui.Key {
+	keys := make([]tui.Key, len(names))
+	for idx, name := range names {
+		keys[idx] = parseKeyChord(name)
+		switch keys[idx].Type {
+		case tui.Change, tui.LeftClick, tui.RightClick, tui.DoubleClick:
+			errorExit("invalid key in sequence: " + name)
 		}
+	}
+	return keys
+}
+
+func parseKeymap(keymap map[tui.Key][]action, sequences *[]keySequence, str string) {
+	masked := executeRegexp.ReplaceAllStringFunc(str, func(src string) string {
+		matches := executeRegexp.FindStringSubmatch(src)
+		prefix := ":" + strings.ToLower(matches[1]+matches[2])
 		return prefix + "(" + strings.Repeat(" ", len(src)-len(prefix)-2) + ")"
 	})
 	masked = strings.Replace(masked, "::", string([]rune{escapedColon, ':'}), -1)
@@ -629,13 +808,17 @@ func parseKeymap(keymap map[int][]action, str string) {
 		if len(pair) < 2 {
 			errorExit("bind action not specified: " + origPairStr)
 		}
-		var key int
+		var key tui.Key
+		var sequence []tui.Key
+		names := strings.Fields(pair[0])
 		if len(pair[0]) == 1 && pair[0][0] == escapedColon {
-			key = ':' + tui.AltZ
+			key = tui.RuneKey(':', 0)
 		} else if len(pair[0]) == 1 && pair[0][0] == escapedComma {
-			key = ',' + tui.AltZ
+			key = tui.RuneKey(',', 0)
 		} else if len(pair[0]) == 1 && pair[0][0] == escapedPlus {
-			key = '+' + tui.AltZ
+			key = tui.RuneKey('+', 0)
+		} else if len(names) > 1 {
+			sequence = parseKeySequence(names)
 		} else {
 			keys := parseKeyChords(pair[0], "key name required")
 			key = firstKey(keys)
@@ -702,6 +885,12 @@ func parseKeymap(keymap map[int][]action, str string) {
 				appendAction(actUnixWordRubout)
 			case "yank":
 				appendAction(actYank)
+			case "yank-pop":
+				appendAction(actYankPop)
+			case "undo":
+				appendAction(actUndo)
+			case "redo":
+				appendAction(actRedo)
 			case "backward-kill-word":
 				appendAction(actBackwardKillWord)
 			case "toggle-down":
@@ -714,6 +903,14 @@ func parseKeymap(keymap map[int][]action, str string) {
 				appendAction(actToggleOut)
 			case "toggle-all":
 				appendAction(actToggleAll)
+			case "select-range":
+				appendAction(actSelectRange)
+			case "toggle-selected-view":
+				appendAction(actToggleSelectedView)
+			case "move-selected-up":
+				appendAction(actMoveSelectedUp)
+			case "move-selected-down":
+				appendAction(actMoveSelectedDown)
 			case "select-all":
 				appendAction(actSelectAll)
 			case "deselect-all":
@@ -738,12 +935,16 @@ func parseKeymap(keymap map[int][]action, str string) {
 				appendAction(actPreviousHistory)
 			case "next-history":
 				appendAction(actNextHistory)
+			case "history-search":
+				appendAction(actHistorySearch)
 			case "toggle-preview":
 				appendAction(actTogglePreview)
 			case "toggle-preview-wrap":
 				appendAction(actTogglePreviewWrap)
 			case "toggle-sort":
 				appendAction(actToggleSort)
+			case "toggle-track":
+				appendAction(actToggleTrack)
 			case "preview-up":
 				appendAction(actPreviewUp)
 			case "preview-down":
@@ -763,6 +964,8 @@ func parseKeymap(keymap map[int][]action, str string) {
 						offset = len("execute-silent")
 					case actExecuteMulti:
 						offset = len("execute-multi")
+					case actSelectMatching:
+						offset = len("select-matching")
 					default:
 						offset = len("execute")
 					}
@@ -780,10 +983,24 @@ func parseKeymap(keymap map[int][]action, str string) {
 			}
 			prevSpec = ""
 		}
-		keymap[key] = actions
+		if sequence != nil {
+			addKeySequence(sequences, keySequence{sequence, names, actions})
+		} else {
+			keymap[key] = actions
+		}
 	}
 }
 
+func addKeySequence(sequences *[]keySequence, sequence keySequence) {
+	for idx, seq := range *sequences {
+		if seq.matches(sequence.keys) {
+			(*sequences)[idx] = sequence
+			return
+		}
+	}
+	*sequences = append(*sequences, sequence)
+}
+
 func isExecuteAction(str string) actionType {
 	matches := executeRegexp.FindAllStringSubmatch(":"+str, -1)
 	if matches == nil || len(matches) != 1 {
@@ -800,11 +1017,13 @@ func isExecuteAction(str string) actionType {
 		return actExecuteSilent
 	case "execute-multi":
 		return actExecuteMulti
+	case "select-matching":
+		return actSelectMatching
 	}
 	return actIgnore
 }
 
-func parseToggleSort(keymap map[int][]action, str string) {
+func parseToggleSort(keymap map[tui.Key][]action, str string) {
 	keys := parseKeyChords(str, "key name required")
 	if len(keys) != 1 {
 		errorExit("multiple keys specified")
@@ -886,6 +1105,62 @@ func parsePreviewWindow(opts *previewOpts, input string) {
 	}
 }
 
+func parseLayout(str string) layoutType {
+	switch str {
+	case "default":
+		return layoutDefault
+	case "reverse":
+		return layoutReverse
+	case "reverse-list":
+		return layoutReverseList
+	default:
+		errorExit("invalid layout (expected: default / reverse / reverse-list)")
+	}
+	return layoutDefault
+}
+
+func parseInfoStyle(str string) infoStyle {
+	switch str {
+	case "default":
+		return infoDefault
+	case "inline":
+		return infoInline
+	case "hidden":
+		return infoHidden
+	case "right":
+		return infoRight
+	default:
+		errorExit("invalid info style (expected: default / inline / hidden / right)")
+	}
+	return infoDefault
+}
+
+func parsePrintOrder(str string) printOrder {
+	switch str {
+	case "selection":
+		return printOrderSelection
+	case "index":
+		return printOrderIndex
+	case "score":
+		return printOrderScore
+	default:
+		errorExit("invalid print order (expected: selection / index / score)")
+	}
+	return printOrderSelection
+}
+
+func parseKeymapStyle(str string) keymapStyle {
+	switch str {
+	case "emacs":
+		return keymapEmacs
+	case "vi":
+		return keymapVi
+	default:
+		errorExit("invalid keymap (expected: emacs / vi)")
+	}
+	return keymapEmacs
+}
+
 func parseMargin(margin string) [4]sizeSpec {
 	margins := strings.Split(margin, ",")
 	checked := func(str string) sizeSpec {
@@ -937,6 +1212,13 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.History.maxSize = historyMax
 		}
 	}
+	setSession := func(path string) {
+		session, err := NewSession(path)
+		if err != nil {
+			errorExit(err.Error())
+		}
+		opts.Session = session
+	}
 	validateJumpLabels := false
 	for i := 0; i < len(allArgs); i++ {
 		arg := allArgs[i]
@@ -971,11 +1253,14 @@ func parseOptions(opts *Options, allArgs []string) {
 				opts.Expect[k] = v
 			}
 		case "--no-expect":
-			opts.Expect = make(map[int]string)
+			opts.Expect = make(map[tui.Key]string)
 		case "--tiebreak":
 			opts.Criteria = parseTiebreak(nextString(allArgs, &i, "sort criterion required"))
+		case "--keymap":
+			opts.KeymapStyle = parseKeymapStyle(
+				nextString(allArgs, &i, "keymap required (emacs / vi)"))
 		case "--bind":
-			parseKeymap(opts.Keymap, nextString(allArgs, &i, "bind expression required"))
+			parseKeymap(opts.Keymap, &opts.Sequences, nextString(allArgs, &i, "bind expression required"))
 		case "--color":
 			spec := optionalNextString(allArgs, &i)
 			if len(spec) == 0 {
@@ -999,6 +1284,10 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.Tac = true
 		case "--no-tac":
 			opts.Tac = false
+		case "--follow":
+			opts.Follow = true
+		case "--no-follow":
+			opts.Follow = false
 		case "-i":
 			opts.Case = CaseIgnore
 		case "+i":
@@ -1007,6 +1296,8 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.Multi = true
 		case "+m", "--no-multi":
 			opts.Multi = false
+		case "--max-selections":
+			opts.MaxSelect = nextInt(allArgs, &i, "maximum number of selections required")
 		case "--ansi":
 			opts.Ansi = true
 		case "--no-ansi":
@@ -1025,14 +1316,21 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.Bold = true
 		case "--no-bold":
 			opts.Bold = false
+		case "--layout":
+			opts.Layout = parseLayout(
+				nextString(allArgs, &i, "layout required (default / reverse / reverse-list)"))
 		case "--reverse":
-			opts.Reverse = true
+			opts.Layout = layoutReverse
 		case "--no-reverse":
-			opts.Reverse = false
+			opts.Layout = layoutDefault
 		case "--cycle":
 			opts.Cycle = true
 		case "--no-cycle":
 			opts.Cycle = false
+		case "--track":
+			opts.Track = true
+		case "--no-track":
+			opts.Track = false
 		case "--hscroll":
 			opts.Hscroll = true
 		case "--no-hscroll":
@@ -1043,10 +1341,33 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.FileWord = true
 		case "--no-filepath-word":
 			opts.FileWord = false
+		case "--info":
+			opts.Info = parseInfoStyle(
+				nextString(allArgs, &i, "info style required (default / inline / hidden / right)"))
 		case "--inline-info":
-			opts.InlineInfo = true
+			opts.Info = infoInline
 		case "--no-inline-info":
-			opts.InlineInfo = false
+			opts.Info = infoDefault
+		case "--separator":
+			opts.Separator = nextString(allArgs, &i, "separator string required")
+		case "--no-separator":
+			opts.Separator = ""
+		case "--scrollbar":
+			opts.Scrollbar = nextString(allArgs, &i, "scrollbar character required")
+		case "--no-scrollbar":
+			opts.Scrollbar = ""
+		case "--pointer":
+			opts.Pointer = nextString(allArgs, &i, "pointer string required")
+		case "--marker":
+			opts.Marker = nextString(allArgs, &i, "marker string required")
+		case "--gutter":
+			opts.Gutter = true
+		case "--no-gutter":
+			opts.Gutter = false
+		case "--line-numbers":
+			opts.LineNumbers = true
+		case "--no-line-numbers":
+			opts.LineNumbers = false
 		case "--jump-labels":
 			opts.JumpLabels = nextString(allArgs, &i, "label characters required")
 			validateJumpLabels = true
@@ -1070,6 +1391,13 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.PrintQuery = true
 		case "--no-print-query":
 			opts.PrintQuery = false
+		case "--print-order":
+			opts.PrintOrder = parsePrintOrder(
+				nextString(allArgs, &i, "print order required (selection / index / score)"))
+		case "--output-format":
+			opts.OutputFmt = nextString(allArgs, &i, "output format required")
+		case "--no-output-format":
+			opts.OutputFmt = ""
 		case "--prompt":
 			opts.Prompt = nextString(allArgs, &i, "prompt string required")
 		case "--sync":
@@ -1080,10 +1408,18 @@ func parseOptions(opts *Options, allArgs []string) {
 			opts.Sync = false
 		case "--no-history":
 			opts.History = nil
+		case "--config", "--profile":
+			errorExit(arg + " must precede the other options")
 		case "--history":
 			setHistory(nextString(allArgs, &i, "history file path required"))
 		case "--history-size":
 			setHistoryMax(nextInt(allArgs, &i, "history max size required"))
+		case "--history-key":
+			opts.HistoryKey = nextString(allArgs, &i, "history key required")
+		case "--session":
+			setSession(nextString(allArgs, &i, "session file path required"))
+		case "--no-session":
+			opts.Session = nil
 		case "--no-header":
 			opts.Header = []string{}
 		case "--no-header-lines":
@@ -1117,14 +1453,23 @@ func parseOptions(opts *Options, allArgs []string) {
 				nextString(allArgs, &i, "margin required (TRBL / TB,RL / T,RL,B / T,R,B,L)"))
 		case "--tabstop":
 			opts.Tabstop = nextInt(allArgs, &i, "tab stop required")
+		case "--tabular":
+			opts.Tabular = true
+			opts.TabularMax = 0
+		case "--no-tabular":
+			opts.Tabular = false
 		case "--clear":
 			opts.ClearOnExit = true
 		case "--no-clear":
 			opts.ClearOnExit = false
 		case "--version":
 			opts.Version = true
+		case "--list-themes":
+			opts.ListThemes = true
 		default:
-			if match, value := optString(arg, "--algo="); match {
+			if match, _ := optString(arg, "--config=", "--profile="); match {
+				errorExit(strings.SplitN(arg, "=", 2)[0] + " must precede the other options")
+			} else if match, value := optString(arg, "--algo="); match {
 				opts.FuzzyAlgo = parseAlgo(value)
 			} else if match, value := optString(arg, "-q", "--query="); match {
 				opts.Query = value
@@ -1155,11 +1500,17 @@ func parseOptions(opts *Options, allArgs []string) {
 			} else if match, value := optString(arg, "--color="); match {
 				opts.Theme = parseTheme(opts.Theme, value)
 			} else if match, value := optString(arg, "--bind="); match {
-				parseKeymap(opts.Keymap, value)
+				parseKeymap(opts.Keymap, &opts.Sequences, value)
 			} else if match, value := optString(arg, "--history="); match {
 				setHistory(value)
 			} else if match, value := optString(arg, "--history-size="); match {
 				setHistoryMax(atoi(value))
+			} else if match, value := optString(arg, "--history-key="); match {
+				opts.HistoryKey = value
+			} else if match, value := optString(arg, "--session="); match {
+				setSession(value)
+			} else if match, value := optString(arg, "--max-selections="); match {
+				opts.MaxSelect = atoi(value)
 			} else if match, value := optString(arg, "--header="); match {
 				opts.Header = strLines(value)
 			} else if match, value := optString(arg, "--header-lines="); match {
@@ -1172,8 +1523,29 @@ func parseOptions(opts *Options, allArgs []string) {
 				opts.Margin = parseMargin(value)
 			} else if match, value := optString(arg, "--tabstop="); match {
 				opts.Tabstop = atoi(value)
+			} else if match, value := optString(arg, "--tabular="); match {
+				opts.Tabular = true
+				opts.TabularMax = atoi(value)
 			} else if match, value := optString(arg, "--hscroll-off="); match {
 				opts.HscrollOff = atoi(value)
+			} else if match, value := optString(arg, "--layout="); match {
+				opts.Layout = parseLayout(value)
+			} else if match, value := optString(arg, "--keymap="); match {
+				opts.KeymapStyle = parseKeymapStyle(value)
+			} else if match, value := optString(arg, "--info="); match {
+				opts.Info = parseInfoStyle(value)
+			} else if match, value := optString(arg, "--print-order="); match {
+				opts.PrintOrder = parsePrintOrder(value)
+			} else if match, value := optString(arg, "--output-format="); match {
+				opts.OutputFmt = value
+			} else if match, value := optString(arg, "--separator="); match {
+				opts.Separator = value
+			} else if match, value := optString(arg, "--scrollbar="); match {
+				opts.Scrollbar = value
+			} else if match, value := optString(arg, "--pointer="); match {
+				opts.Pointer = value
+			} else if match, value := optString(arg, "--marker="); match {
+				opts.Marker = value
 			} else if match, value := optString(arg, "--jump-labels="); match {
 				opts.JumpLabels = value
 			} else {
@@ -1194,10 +1566,23 @@ func parseOptions(opts *Options, allArgs []string) {
 		errorExit("tab stop must be a positive integer")
 	}
 
+	if opts.TabularMax < 0 {
+		errorExit("maximum column width must be a non-negative integer")
+	}
+
 	if len(opts.JumpLabels) == 0 {
 		errorExit("empty jump labels")
 	}
 
+	if len(opts.Scrollbar) > 0 &&
+		(utf8.RuneCountInString(opts.Scrollbar) != 1 || util.RuneWidth([]rune(opts.Scrollbar)[0], 0, 1) != 1) {
+		errorExit("scrollbar should be a single character of width 1")
+	}
+
+	if strings.IndexFunc(opts.Pointer+opts.Marker, unicode.IsControl) >= 0 {
+		errorExit("pointer and marker should not contain control characters")
+	}
+
 	if validateJumpLabels {
 		for _, r := range opts.JumpLabels {
 			if r < 32 || r > 126 {
@@ -1208,20 +1593,40 @@ func parseOptions(opts *Options, allArgs []string) {
 }
 
 func postProcessOptions(opts *Options) {
+	if opts.MaxSelect < 0 {
+		errorExit("maximum number of selections must be a non-negative integer")
+	}
+
 	if util.IsWindows() && opts.Height.size > 0 {
 		errorExit("--height option is currently not supported on Windows")
 	}
+	// Start with the query of the previous session unless given
+	if opts.Session != nil && len(opts.Query) == 0 {
+		opts.Query = opts.Session.query
+	}
+
+	if opts.History != nil && len(opts.HistoryKey) > 0 {
+		opts.History.setKey(opts.HistoryKey)
+	}
+
 	// Default actions for CTRL-N / CTRL-P when --history is set
 	if opts.History != nil {
-		if _, prs := opts.Keymap[tui.CtrlP]; !prs {
-			opts.Keymap[tui.CtrlP] = toActions(actPreviousHistory)
+		if _, prs := opts.Keymap[tui.KeyOf(tui.CtrlP)]; !prs {
+			opts.Keymap[tui.KeyOf(tui.CtrlP)] = toActions(actPreviousHistory)
 		}
-		if _, prs := opts.Keymap[tui.CtrlN]; !prs {
-			opts.Keymap[tui.CtrlN] = toActions(actNextHistory)
+		if _, prs := opts.Keymap[tui.KeyOf(tui.CtrlN)]; !prs {
+			opts.Keymap[tui.KeyOf(tui.CtrlN)] = toActions(actNextHistory)
 		}
 	}
 
 	// Extend the default key map
+	for _, sequence := range opts.Sequences {
+		for _, act := range sequence.actions {
+			if act.t == actToggleSort {
+				opts.ToggleSort = true
+			}
+		}
+	}
 	keymap := defaultKeymap()
 	for key, actions := range opts.Keymap {
 		for _, act := range actions {
@@ -1230,8 +1635,23 @@ func postProcessOptions(opts *Options) {
 			}
 		}
 		keymap[key] = actions
+		// CTRL-I, CTRL-M, and CTRL-[ are also bound to TAB, ENTER, and ESC
+		// unless they are bound explicitly, as legacy terminals cannot tell
+		// them apart
+		if legacy, ok := tui.LegacyKey(key); ok {
+			if _, prs := opts.Keymap[legacy]; !prs {
+				keymap[legacy] = actions
+			}
+		}
 	}
 	opts.Keymap = keymap
+	for key, name := range opts.Expect {
+		if legacy, ok := tui.LegacyKey(key); ok {
+			if _, prs := opts.Expect[legacy]; !prs {
+				opts.Expect[legacy] = name
+			}
+		}
+	}
 
 	// If we're not using extended search mode, --nth option becomes irrelevant
 	// if it contains the whole range
@@ -1249,14 +1669,32 @@ func postProcessOptions(opts *Options) {
 func ParseOptions() *Options {
 	opts := defaultOptions()
 
-	// Options from Env var
 	words, _ := shellwords.Parse(os.Getenv("FZF_DEFAULT_OPTS"))
+
+	// Options from the configuration file, the global section first and then
+	// the selected profile
+	configFile := os.Getenv("FZF_DEFAULT_OPTS_FILE")
+	profile := ""
+	words = words[scanConfigOptions(words, &configFile, &profile):]
+	args := os.Args[1:]
+	args = args[scanConfigOptions(args, &configFile, &profile):]
+	if len(configFile) > 0 {
+		config, err := readConfig(configFile, profile)
+		if err != nil {
+			errorExit(err.Error())
+		}
+		parseOptions(opts, config)
+	} else if len(profile) > 0 {
+		errorExit("profile requires a configuration file: " + profile)
+	}
+
+	// Options from Env var
 	if len(words) > 0 {
 		parseOptions(opts, words)
 	}
 
 	// Options from command-line arguments
-	parseOptions(opts, os.Args[1:])
+	parseOptions(opts, args)
 
 	postProcessOptions(opts)
 	return opts
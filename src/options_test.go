@@ -125,7 +125,7 @@ func TestIrrelevantNth(t *testing.T) {
 
 func TestParseKeys(t *testing.T) {
 	pairs := parseKeyChords("ctrl-z,alt-z,f2,@,Alt-a,!,ctrl-G,J,g,ctrl-alt-a,ALT-enter,alt-SPACE", "")
-	check := func(i int, s string) {
+	check := func(i tui.Key, s string) {
 		if pairs[i] != s {
 			t.Errorf("%s != %s", pairs[i], s)
 		}
@@ -133,49 +133,65 @@ func TestParseKeys(t *testing.T) {
 	if len(pairs) != 12 {
 		t.Error(12)
 	}
-	check(tui.CtrlZ, "ctrl-z")
-	check(tui.AltZ, "alt-z")
-	check(tui.F2, "f2")
-	check(tui.AltZ+'@', "@")
-	check(tui.AltA, "Alt-a")
-	check(tui.AltZ+'!', "!")
-	check(tui.CtrlA+'g'-'a', "ctrl-G")
-	check(tui.AltZ+'J', "J")
-	check(tui.AltZ+'g', "g")
-	check(tui.CtrlAltA, "ctrl-alt-a")
-	check(tui.CtrlAltM, "ALT-enter")
-	check(tui.AltSpace, "alt-SPACE")
+	check(tui.KeyOf(tui.CtrlZ), "ctrl-z")
+	check(tui.RuneKey('z', tui.ModAlt), "alt-z")
+	check(tui.KeyOf(tui.F2), "f2")
+	check(tui.RuneKey('@', 0), "@")
+	check(tui.RuneKey('a', tui.ModAlt), "Alt-a")
+	check(tui.RuneKey('!', 0), "!")
+	check(tui.KeyOf(tui.CtrlA+'g'-'a'), "ctrl-G")
+	check(tui.RuneKey('J', 0), "J")
+	check(tui.RuneKey('g', 0), "g")
+	check(tui.Key{Type: tui.CtrlA, Mod: tui.ModAlt}, "ctrl-alt-a")
+	check(tui.Key{Type: tui.CtrlM, Mod: tui.ModAlt}, "ALT-enter")
+	check(tui.RuneKey(' ', tui.ModAlt), "alt-SPACE")
 
 	// Synonyms
 	pairs = parseKeyChords("enter,Return,space,tab,btab,esc,up,down,left,right", "")
 	if len(pairs) != 9 {
 		t.Error(9)
 	}
-	check(tui.CtrlM, "Return")
-	check(tui.AltZ+' ', "space")
-	check(tui.Tab, "tab")
-	check(tui.BTab, "btab")
-	check(tui.ESC, "esc")
-	check(tui.Up, "up")
-	check(tui.Down, "down")
-	check(tui.Left, "left")
-	check(tui.Right, "right")
+	check(tui.KeyOf(tui.CtrlM), "Return")
+	check(tui.RuneKey(' ', 0), "space")
+	check(tui.KeyOf(tui.Tab), "tab")
+	check(tui.KeyOf(tui.BTab), "btab")
+	check(tui.KeyOf(tui.ESC), "esc")
+	check(tui.KeyOf(tui.Up), "up")
+	check(tui.KeyOf(tui.Down), "down")
+	check(tui.KeyOf(tui.Left), "left")
+	check(tui.KeyOf(tui.Right), "right")
 
 	pairs = parseKeyChords("Tab,Ctrl-I,PgUp,page-up,pgdn,Page-Down,Home,End,Alt-BS,Alt-BSpace,shift-left,shift-right,btab,shift-tab,return,Enter,bspace", "")
-	if len(pairs) != 11 {
-		t.Error(11)
-	}
-	check(tui.Tab, "Ctrl-I")
-	check(tui.PgUp, "page-up")
-	check(tui.PgDn, "Page-Down")
-	check(tui.Home, "Home")
-	check(tui.End, "End")
-	check(tui.AltBS, "Alt-BSpace")
-	check(tui.SLeft, "shift-left")
-	check(tui.SRight, "shift-right")
-	check(tui.BTab, "shift-tab")
-	check(tui.CtrlM, "Enter")
-	check(tui.BSpace, "bspace")
+	if len(pairs) != 12 {
+		t.Error(12)
+	}
+	check(tui.KeyOf(tui.Tab), "Tab")
+	check(tui.RuneKey('i', tui.ModCtrl), "Ctrl-I")
+	check(tui.KeyOf(tui.PgUp), "page-up")
+	check(tui.KeyOf(tui.PgDn), "Page-Down")
+	check(tui.KeyOf(tui.Home), "Home")
+	check(tui.KeyOf(tui.End), "End")
+	check(tui.Key{Type: tui.BSpace, Mod: tui.ModAlt}, "Alt-BSpace")
+	check(tui.Key{Type: tui.Left, Mod: tui.ModShift}, "shift-left")
+	check(tui.Key{Type: tui.Right, Mod: tui.ModShift}, "shift-right")
+	check(tui.KeyOf(tui.BTab), "shift-tab")
+	check(tui.KeyOf(tui.CtrlM), "Enter")
+	check(tui.KeyOf(tui.BSpace), "bspace")
+
+	// Modifiers
+	pairs = parseKeyChords("ctrl-up,alt-shift-down,shift-f5,ctrl-/,Ctrl-Alt-Shift-Home,alt--,shift-a,ctrl-shift-tab,alt-ctrl-space", "")
+	if len(pairs) != 9 {
+		t.Error(9)
+	}
+	check(tui.Key{Type: tui.Up, Mod: tui.ModCtrl}, "ctrl-up")
+	check(tui.Key{Type: tui.Down, Mod: tui.ModAlt | tui.ModShift}, "alt-shift-down")
+	check(tui.Key{Type: tui.F5, Mod: tui.ModShift}, "shift-f5")
+	check(tui.RuneKey('/', tui.ModCtrl), "ctrl-/")
+	check(tui.Key{Type: tui.Home, Mod: tui.ModCtrl | tui.ModAlt | tui.ModShift}, "Ctrl-Alt-Shift-Home")
+	check(tui.RuneKey('-', tui.ModAlt), "alt--")
+	check(tui.RuneKey('A', 0), "shift-a")
+	check(tui.Key{Type: tui.BTab, Mod: tui.ModCtrl}, "ctrl-shift-tab")
+	check(tui.Key{Type: tui.CtrlSpace, Mod: tui.ModAlt}, "alt-ctrl-space")
 }
 
 func TestParseKeysWithComma(t *testing.T) {
@@ -184,7 +200,7 @@ func TestParseKeysWithComma(t *testing.T) {
 			t.Errorf("%d != %d", a, b)
 		}
 	}
-	check := func(pairs map[int]string, i int, s string) {
+	check := func(pairs map[tui.Key]string, i tui.Key, s string) {
 		if pairs[i] != s {
 			t.Errorf("%s != %s", pairs[i], s)
 		}
@@ -192,41 +208,42 @@ func TestParseKeysWithComma(t *testing.T) {
 
 	pairs := parseKeyChords(",", "")
 	checkN(len(pairs), 1)
-	check(pairs, tui.AltZ+',', ",")
+	check(pairs, tui.RuneKey(',', 0), ",")
 
 	pairs = parseKeyChords(",,a,b", "")
 	checkN(len(pairs), 3)
-	check(pairs, tui.AltZ+'a', "a")
-	check(pairs, tui.AltZ+'b', "b")
-	check(pairs, tui.AltZ+',', ",")
+	check(pairs, tui.RuneKey('a', 0), "a")
+	check(pairs, tui.RuneKey('b', 0), "b")
+	check(pairs, tui.RuneKey(',', 0), ",")
 
 	pairs = parseKeyChords("a,b,,", "")
 	checkN(len(pairs), 3)
-	check(pairs, tui.AltZ+'a', "a")
-	check(pairs, tui.AltZ+'b', "b")
-	check(pairs, tui.AltZ+',', ",")
+	check(pairs, tui.RuneKey('a', 0), "a")
+	check(pairs, tui.RuneKey('b', 0), "b")
+	check(pairs, tui.RuneKey(',', 0), ",")
 
 	pairs = parseKeyChords("a,,,b", "")
 	checkN(len(pairs), 3)
-	check(pairs, tui.AltZ+'a', "a")
-	check(pairs, tui.AltZ+'b', "b")
-	check(pairs, tui.AltZ+',', ",")
+	check(pairs, tui.RuneKey('a', 0), "a")
+	check(pairs, tui.RuneKey('b', 0), "b")
+	check(pairs, tui.RuneKey(',', 0), ",")
 
 	pairs = parseKeyChords("a,,,b,c", "")
 	checkN(len(pairs), 4)
-	check(pairs, tui.AltZ+'a', "a")
-	check(pairs, tui.AltZ+'b', "b")
-	check(pairs, tui.AltZ+'c', "c")
-	check(pairs, tui.AltZ+',', ",")
+	check(pairs, tui.RuneKey('a', 0), "a")
+	check(pairs, tui.RuneKey('b', 0), "b")
+	check(pairs, tui.RuneKey('c', 0), "c")
+	check(pairs, tui.RuneKey(',', 0), ",")
 
 	pairs = parseKeyChords(",,,", "")
 	checkN(len(pairs), 1)
-	check(pairs, tui.AltZ+',', ",")
+	check(pairs, tui.RuneKey(',', 0), ",")
 }
 
 func TestBind(t *testing.T) {
 	keymap := defaultKeymap()
-	check := func(keyName int, arg1 string, types ...actionType) {
+	sequences := []keySequence{}
+	check := func(keyName tui.Key, arg1 string, types ...actionType) {
 		if len(keymap[keyName]) != len(types) {
 			t.Errorf("invalid number of actions (%d != %d)", len(types), len(keymap[keyName]))
 			return
@@ -240,36 +257,69 @@ func TestBind(t *testing.T) {
 			t.Errorf("invalid action argument: (%s != %s)", arg1, keymap[keyName][0].a)
 		}
 	}
-	check(tui.CtrlA, "", actBeginningOfLine)
-	parseKeymap(keymap,
+	check(tui.KeyOf(tui.CtrlA), "", actBeginningOfLine)
+	parseKeymap(keymap, &sequences,
 		"ctrl-a:kill-line,ctrl-b:toggle-sort+up+down,c:page-up,alt-z:page-down,"+
 			"f1:execute(ls {})+abort,f2:execute/echo {}, {}, {}/,f3:execute[echo '({})'],f4:execute;less {};,"+
 			"alt-a:execute-Multi@echo (,),[,],/,:,;,%,{}@,alt-b:execute;echo (,),[,],/,:,@,%,{};,"+
 			"x:Execute(foo+bar),X:execute/bar+baz/"+
 			",,:abort,::accept,+:execute:++\nfoobar,Y:execute(baz)+up")
-	check(tui.CtrlA, "", actKillLine)
-	check(tui.CtrlB, "", actToggleSort, actUp, actDown)
-	check(tui.AltZ+'c', "", actPageUp)
-	check(tui.AltZ+',', "", actAbort)
-	check(tui.AltZ+':', "", actAccept)
-	check(tui.AltZ, "", actPageDown)
-	check(tui.F1, "ls {}", actExecute, actAbort)
-	check(tui.F2, "echo {}, {}, {}", actExecute)
-	check(tui.F3, "echo '({})'", actExecute)
-	check(tui.F4, "less {}", actExecute)
-	check(tui.AltZ+'x', "foo+bar", actExecute)
-	check(tui.AltZ+'X', "bar+baz", actExecute)
-	check(tui.AltA, "echo (,),[,],/,:,;,%,{}", actExecuteMulti)
-	check(tui.AltB, "echo (,),[,],/,:,@,%,{}", actExecute)
-	check(tui.AltZ+'+', "++\nfoobar,Y:execute(baz)+up", actExecute)
+	check(tui.KeyOf(tui.CtrlA), "", actKillLine)
+	check(tui.KeyOf(tui.CtrlB), "", actToggleSort, actUp, actDown)
+	check(tui.RuneKey('c', 0), "", actPageUp)
+	check(tui.RuneKey(',', 0), "", actAbort)
+	check(tui.RuneKey(':', 0), "", actAccept)
+	check(tui.RuneKey('z', tui.ModAlt), "", actPageDown)
+	check(tui.KeyOf(tui.F1), "ls {}", actExecute, actAbort)
+	check(tui.KeyOf(tui.F2), "echo {}, {}, {}", actExecute)
+	check(tui.KeyOf(tui.F3), "echo '({})'", actExecute)
+	check(tui.KeyOf(tui.F4), "less {}", actExecute)
+	check(tui.RuneKey('x', 0), "foo+bar", actExecute)
+	check(tui.RuneKey('X', 0), "bar+baz", actExecute)
+	check(tui.RuneKey('a', tui.ModAlt), "echo (,),[,],/,:,;,%,{}", actExecuteMulti)
+	check(tui.RuneKey('b', tui.ModAlt), "echo (,),[,],/,:,@,%,{}", actExecute)
+	check(tui.RuneKey('+', 0), "++\nfoobar,Y:execute(baz)+up", actExecute)
 
 	for idx, char := range []rune{'~', '!', '@', '#', '$', '%', '^', '&', '*', '|', ';', '/'} {
-		parseKeymap(keymap, fmt.Sprintf("%d:execute%cfoobar%c", idx%10, char, char))
-		check(tui.AltZ+int([]rune(fmt.Sprintf("%d", idx%10))[0]), "foobar", actExecute)
+		parseKeymap(keymap, &sequences, fmt.Sprintf("%d:execute%cfoobar%c", idx%10, char, char))
+		check(tui.RuneKey([]rune(fmt.Sprintf("%d", idx%10))[0], 0), "foobar", actExecute)
 	}
 
-	parseKeymap(keymap, "f1:abort")
-	check(tui.F1, "", actAbort)
+	parseKeymap(keymap, &sequences, "f1:abort")
+	check(tui.KeyOf(tui.F1), "", actAbort)
+
+	parseKeymap(keymap, &sequences, "f5:select-matching(^foo, bar)+select-range,f6:Select-Matching[(baz)],f7:select-matching:a+b")
+	check(tui.KeyOf(tui.F5), "^foo, bar", actSelectMatching, actSelectRange)
+	check(tui.KeyOf(tui.F6), "(baz)", actSelectMatching)
+	check(tui.KeyOf(tui.F7), "a+b", actSelectMatching)
+
+	parseKeymap(keymap, &sequences, "f8:toggle-selected-view,alt-up:move-selected-up,alt-down:move-selected-down")
+	check(tui.KeyOf(tui.F8), "", actToggleSelectedView)
+	check(tui.Key{Type: tui.Up, Mod: tui.ModAlt}, "", actMoveSelectedUp)
+	check(tui.Key{Type: tui.Down, Mod: tui.ModAlt}, "", actMoveSelectedDown)
+}
+
+func TestBindSequence(t *testing.T) {
+	keymap := defaultKeymap()
+	sequences := []keySequence{}
+	parseKeymap(keymap, &sequences, "ctrl-x ctrl-e:execute(vim {}),g g:page-up,g  G:page-down,g g:up, :down")
+	if len(sequences) != 3 {
+		t.Fatalf("invalid number of sequences: %d", len(sequences))
+	}
+	if !sequences[0].matches([]tui.Key{tui.KeyOf(tui.CtrlX), tui.KeyOf(tui.CtrlE)}) ||
+		sequences[0].actions[0].t != actExecute || sequences[0].actions[0].a != "vim {}" {
+		t.Errorf("invalid sequence: %v", sequences[0])
+	}
+	if !sequences[1].matches([]tui.Key{tui.RuneKey('g', 0), tui.RuneKey('g', 0)}) ||
+		sequences[1].actions[0].t != actUp {
+		t.Errorf("sequence should be overridden: %v", sequences[1])
+	}
+	if !sequences[2].matches([]tui.Key{tui.RuneKey('g', 0), tui.RuneKey('G', 0)}) {
+		t.Errorf("invalid sequence: %v", sequences[2])
+	}
+	if keymap[tui.RuneKey(' ', 0)][0].t != actDown {
+		t.Errorf("space should be a single key")
+	}
 }
 
 func TestColorSpec(t *testing.T) {
@@ -294,7 +344,7 @@ func TestColorSpec(t *testing.T) {
 	}
 
 	customized := parseTheme(theme, "fg:231,bg:232")
-	if customized.Fg != 231 || customized.Bg != 232 {
+	if customized.Fg.Color != 231 || customized.Bg.Color != 232 {
 		t.Errorf("color not customized")
 	}
 	if *tui.Dark256 == *customized {
@@ -319,13 +369,32 @@ func TestParseNilTheme(t *testing.T) {
 		t.Errorf("color is disabled. keep it that way.")
 	}
 	newTheme = parseTheme(theme, "prompt:12,dark,prompt:13")
-	if newTheme.Prompt != 13 {
+	if newTheme.Prompt.Color != 13 {
 		t.Errorf("color should now be enabled and customized")
 	}
 }
 
+func TestParseThemeAttributes(t *testing.T) {
+	theme := parseTheme(tui.Dark256, "hl:#ff0000:underline,fg+:bold:italic,query:regular,preview-bg:236,separator:-1")
+	if theme.Match.Color != tui.HexToColor("#ff0000") || theme.Match.Attr != tui.Underline {
+		t.Errorf("invalid hl: %v", theme.Match)
+	}
+	if theme.Current.Color != tui.Dark256.Current.Color || theme.Current.Attr != tui.Bold|tui.Italic {
+		t.Errorf("invalid fg+: %v", theme.Current)
+	}
+	if theme.Query.Attr != tui.AttrRegular || theme.PreviewBg.Color != 236 || theme.Separator.Color != -1 {
+		t.Errorf("invalid new slots: %v", theme)
+	}
+
+	// Color without attributes keeps the existing attributes
+	theme = parseTheme(theme, "hl:12")
+	if theme.Match.Color != 12 || theme.Match.Attr != tui.Underline {
+		t.Errorf("attributes should be kept: %v", theme.Match)
+	}
+}
+
 func TestDefaultCtrlNP(t *testing.T) {
-	check := func(words []string, key int, expected actionType) {
+	check := func(words []string, key tui.Key, expected actionType) {
 		opts := defaultOptions()
 		parseOptions(opts, words)
 		postProcessOptions(opts)
@@ -333,23 +402,23 @@ func TestDefaultCtrlNP(t *testing.T) {
 			t.Error()
 		}
 	}
-	check([]string{}, tui.CtrlN, actDown)
-	check([]string{}, tui.CtrlP, actUp)
+	check([]string{}, tui.KeyOf(tui.CtrlN), actDown)
+	check([]string{}, tui.KeyOf(tui.CtrlP), actUp)
 
-	check([]string{"--bind=ctrl-n:accept"}, tui.CtrlN, actAccept)
-	check([]string{"--bind=ctrl-p:accept"}, tui.CtrlP, actAccept)
+	check([]string{"--bind=ctrl-n:accept"}, tui.KeyOf(tui.CtrlN), actAccept)
+	check([]string{"--bind=ctrl-p:accept"}, tui.KeyOf(tui.CtrlP), actAccept)
 
 	f, _ := ioutil.TempFile("", "fzf-history")
 	f.Close()
 	hist := "--history=" + f.Name()
-	check([]string{hist}, tui.CtrlN, actNextHistory)
-	check([]string{hist}, tui.CtrlP, actPreviousHistory)
+	check([]string{hist}, tui.KeyOf(tui.CtrlN), actNextHistory)
+	check([]string{hist}, tui.KeyOf(tui.CtrlP), actPreviousHistory)
 
-	check([]string{hist, "--bind=ctrl-n:accept"}, tui.CtrlN, actAccept)
-	check([]string{hist, "--bind=ctrl-n:accept"}, tui.CtrlP, actPreviousHistory)
+	check([]string{hist, "--bind=ctrl-n:accept"}, tui.KeyOf(tui.CtrlN), actAccept)
+	check([]string{hist, "--bind=ctrl-n:accept"}, tui.KeyOf(tui.CtrlP), actPreviousHistory)
 
-	check([]string{hist, "--bind=ctrl-p:accept"}, tui.CtrlN, actNextHistory)
-	check([]string{hist, "--bind=ctrl-p:accept"}, tui.CtrlP, actAccept)
+	check([]string{hist, "--bind=ctrl-p:accept"}, tui.KeyOf(tui.CtrlN), actNextHistory)
+	check([]string{hist, "--bind=ctrl-p:accept"}, tui.KeyOf(tui.CtrlP), actAccept)
 }
 
 func optsFor(words ...string) *Options {
@@ -421,3 +490,76 @@ func TestAdditiveExpect(t *testing.T) {
 		t.Error(opts.Expect)
 	}
 }
+
+func TestLayoutAndInfo(t *testing.T) {
+	opts := optsFor()
+	if opts.Layout != layoutDefault || opts.Info != infoDefault || len(opts.Separator) > 0 {
+		t.Error()
+	}
+
+	opts = optsFor("--reverse", "--inline-info")
+	if opts.Layout != layoutReverse || opts.Info != infoInline {
+		t.Error()
+	}
+
+	opts = optsFor("--reverse", "--layout=reverse-list", "--info", "hidden", "--separator=─")
+	if opts.Layout != layoutReverseList || opts.Info != infoHidden || opts.Separator != "─" {
+		t.Error()
+	}
+
+	opts = optsFor("--layout", "reverse", "--info=right", "--no-reverse", "--separator=-", "--no-separator")
+	if opts.Layout != layoutDefault || opts.Info != infoRight || len(opts.Separator) > 0 {
+		t.Error()
+	}
+}
+
+func TestLegacyKeyAliases(t *testing.T) {
+	check := func(words []string, key tui.Key, expected actionType) {
+		opts := defaultOptions()
+		parseOptions(opts, words)
+		postProcessOptions(opts)
+		if opts.Keymap[key][0].t != expected {
+			t.Errorf("%v: %v", words, key)
+		}
+	}
+	check([]string{"--bind=ctrl-m:abort"}, tui.KeyOf(tui.CtrlM), actAbort)
+	check([]string{"--bind=ctrl-m:abort"}, tui.RuneKey('m', tui.ModCtrl), actAbort)
+	check([]string{"--bind=ctrl-i:up,tab:down"}, tui.KeyOf(tui.Tab), actDown)
+	check([]string{"--bind=ctrl-i:up,tab:down"}, tui.RuneKey('i', tui.ModCtrl), actUp)
+	check([]string{"--bind=tab:down,ctrl-i:up"}, tui.KeyOf(tui.Tab), actDown)
+	check([]string{"--bind=ctrl-alt-m:abort"}, tui.Key{Type: tui.CtrlM, Mod: tui.ModAlt}, actAbort)
+
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--expect=ctrl-m"})
+	postProcessOptions(opts)
+	if opts.Expect[tui.KeyOf(tui.CtrlM)] != "ctrl-m" {
+		t.Error("ctrl-m should be expected on legacy terminals")
+	}
+}
+
+func TestPointerAndMarker(t *testing.T) {
+	opts := defaultOptions()
+	parseOptions(opts, []string{"--pointer=▶", "--marker", "✓ "})
+	if opts.Pointer != "▶" || opts.Marker != "✓ " || !opts.Gutter {
+		t.Errorf("%q %q", opts.Pointer, opts.Marker)
+	}
+	parseOptions(opts, []string{"--no-gutter"})
+	if opts.Gutter {
+		t.Error("gutter should be hidden")
+	}
+}
+
+func TestPrintOrder(t *testing.T) {
+	opts := defaultOptions()
+	if opts.PrintOrder != printOrderSelection {
+		t.Error("selection order should be the default")
+	}
+	parseOptions(opts, []string{"--print-order=score"})
+	if opts.PrintOrder != printOrderScore {
+		t.Errorf("invalid print order: %d", opts.PrintOrder)
+	}
+	parseOptions(opts, []string{"--print-order", "index"})
+	if opts.PrintOrder != printOrderIndex {
+		t.Errorf("invalid print order: %d", opts.PrintOrder)
+	}
+}
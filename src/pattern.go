@@ -3,6 +3,7 @@ package fzf
 import (
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/junegunn/fzf/src/algo"
 	"github.com/junegunn/fzf/src/util"
@@ -55,6 +56,7 @@ type Pattern struct {
 
 var (
 	_patternCache map[string]*Pattern
+	_patternMutex sync.Mutex
 	_splitRegex   *regexp.Regexp
 	_cache        ChunkCache
 )
@@ -68,7 +70,9 @@ func init() {
 func clearPatternCache() {
 	// We can uniquely identify the pattern for a given string since
 	// search mode and caseMode do not change while the program is running
+	_patternMutex.Lock()
 	_patternCache = make(map[string]*Pattern)
+	_patternMutex.Unlock()
 }
 
 func clearChunkCache() {
@@ -89,7 +93,10 @@ func BuildPattern(fuzzy bool, fuzzyAlgo algo.Algo, extended bool, caseMode Case,
 		asString = string(runes)
 	}
 
+	// The cache is shared by the matcher and the terminal (select-matching)
+	_patternMutex.Lock()
 	cached, found := _patternCache[asString]
+	_patternMutex.Unlock()
 	if found {
 		return cached
 	}
@@ -140,7 +147,9 @@ func BuildPattern(fuzzy bool, fuzzyAlgo algo.Algo, extended bool, caseMode Case,
 	ptr.procFun[termPrefix] = algo.PrefixMatch
 	ptr.procFun[termSuffix] = algo.SuffixMatch
 
+	_patternMutex.Lock()
 	_patternCache[asString] = ptr
+	_patternMutex.Unlock()
 	return ptr
 }
 
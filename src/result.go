@@ -147,16 +147,16 @@ func (result *Result) colorOffsets(matchOffsets []Offset, theme *tui.ColorTheme,
 				if theme != nil {
 					if fg == -1 {
 						if current {
-							fg = theme.Current
+							fg = theme.Current.Color
 						} else {
-							fg = theme.Fg
+							fg = theme.Fg.Color
 						}
 					}
 					if bg == -1 {
 						if current {
-							bg = theme.DarkBg
+							bg = theme.DarkBg.Color
 						} else {
-							bg = theme.Bg
+							bg = theme.Bg.Color
 						}
 					}
 				}
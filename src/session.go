@@ -0,0 +1,102 @@
+package fzf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session is the state of the finder saved on exit with --session so that it
+// can be restored on the next run. Items are identified by their content as
+// their indexes may change.
+type Session struct {
+	path     string
+	query    string
+	focus    *string
+	selected []string
+}
+
+// NewSession returns the session loaded from the file. An empty session is
+// returned if the file does not exist yet.
+func NewSession(path string) (*Session, error) {
+	session := &Session{path: path, selected: []string{}}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return session, nil
+		}
+		if os.IsPermission(err) {
+			return nil, errors.New("permission denied: " + path)
+		}
+		return nil, errors.New("invalid session file: " + err.Error())
+	}
+	for idx, line := range strings.Split(string(data), "\n") {
+		if len(line) == 0 {
+			continue
+		}
+		tokens := strings.SplitN(line, "\t", 2)
+		var value string
+		if len(tokens) == 2 {
+			value, err = strconv.Unquote(tokens[1])
+		}
+		if len(tokens) != 2 || err != nil {
+			return nil, errors.New("invalid session file: " + path + ":" + strconv.Itoa(idx+1))
+		}
+		switch tokens[0] {
+		case "query":
+			session.query = value
+		case "focus":
+			session.focus = &value
+		case "selected":
+			session.selected = append(session.selected, value)
+		}
+	}
+	return session, nil
+}
+
+// save writes the session to the file. Each line holds the name of the field
+// and the quoted value separated by a tab.
+func (s *Session) save() error {
+	lines := []string{"query\t" + strconv.Quote(s.query)}
+	if s.focus != nil {
+		lines = append(lines, "focus\t"+strconv.Quote(*s.focus))
+	}
+	for _, item := range s.selected {
+		lines = append(lines, "selected\t"+strconv.Quote(item))
+	}
+	return writeFileAtomic(s.path, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// sessionRestore keeps track of the items of the session that are yet to be
+// found in the input
+type sessionRestore struct {
+	selected map[string][]int
+	focus    *string
+	focused  *Item
+	scanned  int
+	start    time.Time
+}
+
+func newSessionRestore(session *Session, multi bool) *sessionRestore {
+	selected := make(map[string][]int)
+	if multi {
+		for idx, item := range session.selected {
+			selected[item] = append(selected[item], idx)
+		}
+	}
+	if len(selected) == 0 && session.focus == nil {
+		return nil
+	}
+	return &sessionRestore{
+		selected: selected,
+		focus:    session.focus,
+		start:    time.Now()}
+}
+
+// done returns true if all the items of the session are found
+func (r *sessionRestore) done() bool {
+	return len(r.selected) == 0 && r.focus == nil && r.focused == nil
+}
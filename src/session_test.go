@@ -0,0 +1,113 @@
+package fzf
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/junegunn/fzf/src/util"
+)
+
+func TestSessionFile(t *testing.T) {
+	f, _ := ioutil.TempFile("", "fzf-session")
+	f.Close()
+	os.Remove(f.Name())
+	defer os.Remove(f.Name())
+
+	session, err := NewSession(f.Name())
+	if err != nil || session.focus != nil || len(session.selected) > 0 {
+		t.Errorf("should be empty: %v, %v", session, err)
+	}
+	focus := "multi\nline"
+	session.query = "foo bar"
+	session.focus = &focus
+	session.selected = []string{"tab\there", "\"quoted\"", "tab\there"}
+	if err := session.save(); err != nil {
+		t.Error(err)
+	}
+
+	session, err = NewSession(f.Name())
+	if err != nil || session.query != "foo bar" || *session.focus != focus ||
+		strings.Join(session.selected, "|") != "tab\there|\"quoted\"|tab\there" {
+		t.Errorf("invalid session: %v, %v", session, err)
+	}
+
+	ioutil.WriteFile(f.Name(), []byte("query\tfoo\n"), 0600)
+	if _, err := NewSession(f.Name()); err == nil {
+		t.Error("error expected for the invalid session file")
+	}
+}
+
+func TestRestoreSession(t *testing.T) {
+	var index int32
+	chunkList := NewChunkList(func(item *Item, data []byte) bool {
+		item.text = util.ToChars(data)
+		item.text.Index = index
+		index++
+		return true
+	})
+	focus := "baz"
+	session := &Session{focus: &focus, selected: []string{"qux", "foo", "qux", "none"}}
+	term := &Terminal{
+		multi:    true,
+		reading:  true,
+		selected: make(map[int32]selectedItem),
+		reqBox:   util.NewEventBox(),
+		merger:   EmptyMerger,
+		session:  session}
+	term.restore = newSessionRestore(session, true)
+
+	for _, line := range []string{"foo", "bar", "qux"} {
+		chunkList.Push([]byte(line))
+	}
+	snapshot, _ := chunkList.Snapshot()
+	term.RestoreSession(snapshot)
+	if len(term.selected) != 2 || term.restore.focus == nil || term.restore.scanned != 3 {
+		t.Errorf("invalid restore: %v, %v", term.selected, term.restore)
+	}
+
+	for _, line := range []string{"baz", "qux", "foo"} {
+		chunkList.Push([]byte(line))
+	}
+	snapshot, _ = chunkList.Snapshot()
+	term.RestoreSession(snapshot)
+	if len(term.selected) != 3 || term.restore.focused == nil || term.restore.focused.Index() != 3 {
+		t.Errorf("invalid restore: %v, %v", term.selected, term.restore)
+	}
+
+	// The order of the selection is kept
+	selected := []string{}
+	for _, sel := range term.sortSelected() {
+		selected = append(selected, sel.item.AsString(false))
+	}
+	if strings.Join(selected, ",") != "qux,foo,qux" {
+		t.Errorf("invalid selection: %v", selected)
+	}
+	if _, found := term.selected[5]; found {
+		t.Error("the second foo should not be selected")
+	}
+
+	// Items not found yet remain selected in the saved session
+	f, _ := ioutil.TempFile("", "fzf-session")
+	f.Close()
+	defer os.Remove(f.Name())
+	session.path = f.Name()
+	term.input = []rune("query")
+	if err := term.saveSession(); err != nil {
+		t.Error(err)
+	}
+	if session.query != "query" || session.focus != nil ||
+		strings.Join(session.selected, ",") != "qux,foo,qux,none" {
+		t.Errorf("invalid session: %v", session)
+	}
+
+	// Unless the input is complete
+	term.reading = false
+	if err := term.saveSession(); err != nil {
+		t.Error(err)
+	}
+	if strings.Join(session.selected, ",") != "qux,foo,qux" {
+		t.Errorf("invalid session: %v", session)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"os/signal"
 	"regexp"
 	"sort"
@@ -14,6 +16,7 @@ import (
 	"sync"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/junegunn/fzf/src/tui"
 	"github.com/junegunn/fzf/src/util"
@@ -22,9 +25,11 @@ import (
 // import "github.com/pkg/profile"
 
 var placeholder *regexp.Regexp
+var outputPlaceholder *regexp.Regexp
 
 func init() {
-	placeholder = regexp.MustCompile("\\\\?(?:{\\+?[0-9,-.]*}|{q})")
+	placeholder = regexp.MustCompile("\\\\?(?:{\\+?f?[0-9,-.]*}|{\\+?f?n}|{q})")
+	outputPlaceholder = regexp.MustCompile("\\\\?(?:{\\+?[0-9,-.]*}|{\\+?n}|{q}|{k}|{i})")
 }
 
 type jumpMode int
@@ -40,6 +45,15 @@ type previewer struct {
 	lines   int
 	offset  int
 	enabled bool
+	errLine int
+	status  int
+}
+
+// previewResult is the output of the preview command
+type previewResult struct {
+	output    string
+	errOutput string
+	status    int
 }
 
 type itemLine struct {
@@ -48,74 +62,155 @@ type itemLine struct {
 	label    string
 	queryLen int
 	width    int
+	bar      bool
 	result   Result
 }
 
 var emptyLine = itemLine{}
 
+// tabularCell is the position of a field in the text. The content of the
+// field is in [begin, end) and the trailing whitespace in [end, next).
+type tabularCell struct {
+	begin int
+	end   int
+	next  int
+}
+
+type tabularColumn struct {
+	width int
+	gap   int
+}
+
+type editState struct {
+	input []rune
+	cx    int
+}
+
+// queryEdit records the state of the query before an event and how the
+// actions for the event edited it
+type queryEdit struct {
+	before   editState
+	mode     viMode
+	grouped  bool
+	inserted bool
+	undone   bool
+	yanked   bool
+}
+
 // Terminal represents terminal input/output
 type Terminal struct {
-	initDelay  time.Duration
-	inlineInfo bool
-	prompt     string
-	promptLen  int
-	reverse    bool
-	fullscreen bool
-	hscroll    bool
-	hscrollOff int
-	wordRubout string
-	wordNext   string
-	cx         int
-	cy         int
-	offset     int
-	yanked     []rune
-	input      []rune
-	multi      bool
-	sort       bool
-	toggleSort bool
-	delimiter  Delimiter
-	expect     map[int]string
-	keymap     map[int][]action
-	pressed    string
-	printQuery bool
-	history    *History
-	cycle      bool
-	header     []string
-	header0    []string
-	ansi       bool
-	tabstop    int
-	margin     [4]sizeSpec
-	strong     tui.Attr
-	bordered   bool
-	cleanExit  bool
-	border     tui.Window
-	window     tui.Window
-	pborder    tui.Window
-	pwindow    tui.Window
-	count      int
-	progress   int
-	reading    bool
-	success    bool
-	jumping    jumpMode
-	jumpLabels string
-	printer    func(string)
-	merger     *Merger
-	selected   map[int32]selectedItem
-	version    int64
-	reqBox     *util.EventBox
-	preview    previewOpts
-	previewer  previewer
-	previewBox *util.EventBox
-	eventBox   *util.EventBox
-	mutex      sync.Mutex
-	initFunc   func()
-	prevLines  []itemLine
-	suppress   bool
-	startChan  chan bool
-	slab       *util.Slab
-	theme      *tui.ColorTheme
-	tui        tui.Renderer
-}
+	initDelay      time.Duration
+	info           infoStyle
+	separator      string
+	scrollbar      string
+	dragging       scrollbarTarget
+	prompt         string
+	promptLen      int
+	promptText     string
+	pointer        string
+	pointerLen     int
+	marker         string
+	markerLen      int
+	lineNumbers    bool
+	numberLen      int
+	layout         layoutType
+	fullscreen     bool
+	hscroll        bool
+	hscrollOff     int
+	wordRubout     string
+	wordNext       string
+	cx             int
+	cy             int
+	offset         int
+	killRing       [][]rune
+	yankIndex      int
+	yankFrom       int
+	yanking        bool
+	inserting      bool
+	input          []rune
+	undoStack      []editState
+	redoStack      []editState
+	vi             *viState
+	multi          bool
+	sort           bool
+	toggleSort     bool
+	track          bool
+	follow         bool
+	followMark     int32
+	newItems       int
+	delimiter      Delimiter
+	expect         map[tui.Key]string
+	keymap         map[tui.Key][]action
+	sequences      []keySequence
+	pending        []tui.Event
+	pressed        string
+	printQuery     bool
+	printOrder     printOrder
+	lastStatus     int
+	failure        string
+	failureAt      time.Time
+	readZero       bool
+	outputFmt      string
+	history        *History
+	session        *Session
+	restore        *sessionRestore
+	cycle          bool
+	header         []string
+	header0        []string
+	ansi           bool
+	tabstop        int
+	tabular        bool
+	tabularMax     int
+	columns        []tabularColumn
+	margin         [4]sizeSpec
+	strong         tui.Attr
+	bordered       bool
+	cleanExit      bool
+	border         tui.Window
+	window         tui.Window
+	pborder        tui.Window
+	pwindow        tui.Window
+	count          int
+	progress       int
+	reading        bool
+	success        bool
+	jumping        jumpMode
+	jumpLabels     string
+	printer        func(string)
+	merger         *Merger
+	selected       map[int32]selectedItem
+	maxSelect      int
+	anchor         int32
+	patternBuilder func([]rune) *Pattern
+	listMerger     *Merger
+	viewVersion    int64
+	viewByIndex    bool
+	hidden         int
+	hiddenMerger   *Merger
+	hiddenVersion  int64
+	version        int64
+	reqBox         *util.EventBox
+	preview        previewOpts
+	previewer      previewer
+	previewBox     *util.EventBox
+	eventBox       *util.EventBox
+	mutex          sync.Mutex
+	initFunc       func()
+	prevLines      []itemLine
+	suppress       bool
+	startChan      chan bool
+	slab           *util.Slab
+	theme          *tui.ColorTheme
+	tui            tui.Renderer
+}
+
+type scrollbarTarget int
+
+const (
+	barNone scrollbarTarget = iota
+	barList
+	barPreview
+)
 
 type selectedItem struct {
 	at   time.Time
@@ -136,6 +231,43 @@ func (a byTimeOrder) Less(i, j int) bool {
 	return a[i].at.Before(a[j].at)
 }
 
+type byRankOrder struct {
+	sels  []selectedItem
+	ranks map[int32]int
+}
+
+func (a byRankOrder) Len() int {
+	return len(a.sels)
+}
+
+func (a byRankOrder) Swap(i, j int) {
+	a.sels[i], a.sels[j] = a.sels[j], a.sels[i]
+}
+
+// Less puts the items without the rank after the ones with the rank
+func (a byRankOrder) Less(i, j int) bool {
+	ri, oki := a.ranks[a.sels[i].item.Index()]
+	rj, okj := a.ranks[a.sels[j].item.Index()]
+	if oki && okj {
+		return ri < rj
+	}
+	return oki && !okj
+}
+
+type byIndexOrder []selectedItem
+
+func (a byIndexOrder) Len() int {
+	return len(a)
+}
+
+func (a byIndexOrder) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
+
+func (a byIndexOrder) Less(i, j int) bool {
+	return a[i].item.Index() < a[j].item.Index()
+}
+
 var _spinner = []string{`-`, `\`, `|`, `/`, `-`, `\`, `|`, `/`}
 
 const (
@@ -162,6 +294,37 @@ type action struct {
 
 type actionType int
 
+// keySequence is a sequence of keys bound to actions
+type keySequence struct {
+	keys    []tui.Key
+	names   []string
+	actions []action
+}
+
+// matches returns true if the sequence is the same as the given keys
+func (s keySequence) matches(keys []tui.Key) bool {
+	return len(keys) == len(s.keys) && s.hasPrefix(keys)
+}
+
+// hasPrefix returns true if the sequence starts with the given keys
+func (s keySequence) hasPrefix(keys []tui.Key) bool {
+	if len(keys) > len(s.keys) {
+		return false
+	}
+	for idx, key := range keys {
+		if s.keys[idx] != key {
+			return false
+		}
+	}
+	return true
+}
+
+const keySequenceTimeout = 1 * time.Second
+
+const maxKillRing = 60
+
+const maxUndo = 1000
+
 const (
 	actIgnore actionType = iota
 	actInvalid
@@ -191,6 +354,11 @@ const (
 	actDeselectAll
 	actToggle
 	actToggleAll
+	actSelectRange
+	actSelectMatching
+	actToggleSelectedView
+	actMoveSelectedUp
+	actMoveSelectedDown
 	actToggleDown
 	actToggleUp
 	actToggleIn
@@ -206,6 +374,7 @@ const (
 	actPrintQuery
 	actReplaceQuery
 	actToggleSort
+	actToggleTrack
 	actTogglePreview
 	actTogglePreviewWrap
 	actPreviewUp
@@ -214,11 +383,16 @@ const (
 	actPreviewPageDown
 	actPreviousHistory
 	actNextHistory
+	actHistorySearch
 	actExecute
 	actExecuteSilent
 	actExecuteMulti // Deprecated
 	actSigStop
 	actTop
+	actUndo
+	actRedo
+	actYankPop
+	actPaste
 )
 
 func toActions(types ...actionType) []action {
@@ -229,59 +403,64 @@ func toActions(types ...actionType) []action {
 	return actions
 }
 
-func defaultKeymap() map[int][]action {
-	keymap := make(map[int][]action)
-	keymap[tui.Invalid] = toActions(actInvalid)
-	keymap[tui.Resize] = toActions(actClearScreen)
-	keymap[tui.CtrlA] = toActions(actBeginningOfLine)
-	keymap[tui.CtrlB] = toActions(actBackwardChar)
-	keymap[tui.CtrlC] = toActions(actAbort)
-	keymap[tui.CtrlG] = toActions(actAbort)
-	keymap[tui.CtrlQ] = toActions(actAbort)
-	keymap[tui.ESC] = toActions(actAbort)
-	keymap[tui.CtrlD] = toActions(actDeleteCharEOF)
-	keymap[tui.CtrlE] = toActions(actEndOfLine)
-	keymap[tui.CtrlF] = toActions(actForwardChar)
-	keymap[tui.CtrlH] = toActions(actBackwardDeleteChar)
-	keymap[tui.BSpace] = toActions(actBackwardDeleteChar)
-	keymap[tui.Tab] = toActions(actToggleDown)
-	keymap[tui.BTab] = toActions(actToggleUp)
-	keymap[tui.CtrlJ] = toActions(actDown)
-	keymap[tui.CtrlK] = toActions(actUp)
-	keymap[tui.CtrlL] = toActions(actClearScreen)
-	keymap[tui.CtrlM] = toActions(actAccept)
-	keymap[tui.CtrlN] = toActions(actDown)
-	keymap[tui.CtrlP] = toActions(actUp)
-	keymap[tui.CtrlU] = toActions(actUnixLineDiscard)
-	keymap[tui.CtrlW] = toActions(actUnixWordRubout)
-	keymap[tui.CtrlY] = toActions(actYank)
+func defaultKeymap() map[tui.Key][]action {
+	keymap := make(map[tui.Key][]action)
+	keymap[tui.KeyOf(tui.Invalid)] = toActions(actInvalid)
+	keymap[tui.KeyOf(tui.Resize)] = toActions(actClearScreen)
+	keymap[tui.KeyOf(tui.CtrlA)] = toActions(actBeginningOfLine)
+	keymap[tui.KeyOf(tui.CtrlB)] = toActions(actBackwardChar)
+	keymap[tui.KeyOf(tui.CtrlC)] = toActions(actAbort)
+	keymap[tui.KeyOf(tui.CtrlG)] = toActions(actAbort)
+	keymap[tui.KeyOf(tui.CtrlQ)] = toActions(actAbort)
+	keymap[tui.KeyOf(tui.ESC)] = toActions(actAbort)
+	keymap[tui.KeyOf(tui.CtrlD)] = toActions(actDeleteCharEOF)
+	keymap[tui.KeyOf(tui.CtrlE)] = toActions(actEndOfLine)
+	keymap[tui.KeyOf(tui.CtrlF)] = toActions(actForwardChar)
+	keymap[tui.KeyOf(tui.CtrlH)] = toActions(actBackwardDeleteChar)
+	keymap[tui.KeyOf(tui.BSpace)] = toActions(actBackwardDeleteChar)
+	keymap[tui.KeyOf(tui.Tab)] = toActions(actToggleDown)
+	keymap[tui.KeyOf(tui.BTab)] = toActions(actToggleUp)
+	keymap[tui.KeyOf(tui.CtrlJ)] = toActions(actDown)
+	keymap[tui.KeyOf(tui.CtrlK)] = toActions(actUp)
+	keymap[tui.KeyOf(tui.CtrlL)] = toActions(actClearScreen)
+	keymap[tui.KeyOf(tui.CtrlM)] = toActions(actAccept)
+	keymap[tui.KeyOf(tui.CtrlN)] = toActions(actDown)
+	keymap[tui.KeyOf(tui.CtrlP)] = toActions(actUp)
+	keymap[tui.KeyOf(tui.CtrlU)] = toActions(actUnixLineDiscard)
+	keymap[tui.KeyOf(tui.CtrlW)] = toActions(actUnixWordRubout)
+	keymap[tui.KeyOf(tui.CtrlY)] = toActions(actYank)
+	keymap[tui.RuneKey('/', tui.ModCtrl)] = toActions(actUndo)
 	if !util.IsWindows() {
-		keymap[tui.CtrlZ] = toActions(actSigStop)
-	}
-
-	keymap[tui.AltB] = toActions(actBackwardWord)
-	keymap[tui.SLeft] = toActions(actBackwardWord)
-	keymap[tui.AltF] = toActions(actForwardWord)
-	keymap[tui.SRight] = toActions(actForwardWord)
-	keymap[tui.AltD] = toActions(actKillWord)
-	keymap[tui.AltBS] = toActions(actBackwardKillWord)
-
-	keymap[tui.Up] = toActions(actUp)
-	keymap[tui.Down] = toActions(actDown)
-	keymap[tui.Left] = toActions(actBackwardChar)
-	keymap[tui.Right] = toActions(actForwardChar)
-
-	keymap[tui.Home] = toActions(actBeginningOfLine)
-	keymap[tui.End] = toActions(actEndOfLine)
-	keymap[tui.Del] = toActions(actDeleteChar)
-	keymap[tui.PgUp] = toActions(actPageUp)
-	keymap[tui.PgDn] = toActions(actPageDown)
-
-	keymap[tui.Rune] = toActions(actRune)
-	keymap[tui.Mouse] = toActions(actMouse)
-	keymap[tui.DoubleClick] = toActions(actAccept)
-	keymap[tui.LeftClick] = toActions(actIgnore)
-	keymap[tui.RightClick] = toActions(actToggle)
+		keymap[tui.KeyOf(tui.CtrlZ)] = toActions(actSigStop)
+	}
+
+	keymap[tui.RuneKey('b', tui.ModAlt)] = toActions(actBackwardWord)
+	keymap[tui.Key{Type: tui.Left, Mod: tui.ModShift}] = toActions(actBackwardWord)
+	keymap[tui.Key{Type: tui.Left, Mod: tui.ModCtrl}] = toActions(actBackwardWord)
+	keymap[tui.RuneKey('f', tui.ModAlt)] = toActions(actForwardWord)
+	keymap[tui.Key{Type: tui.Right, Mod: tui.ModShift}] = toActions(actForwardWord)
+	keymap[tui.Key{Type: tui.Right, Mod: tui.ModCtrl}] = toActions(actForwardWord)
+	keymap[tui.RuneKey('d', tui.ModAlt)] = toActions(actKillWord)
+	keymap[tui.RuneKey('y', tui.ModAlt)] = toActions(actYankPop)
+	keymap[tui.Key{Type: tui.BSpace, Mod: tui.ModAlt}] = toActions(actBackwardKillWord)
+
+	keymap[tui.KeyOf(tui.Up)] = toActions(actUp)
+	keymap[tui.KeyOf(tui.Down)] = toActions(actDown)
+	keymap[tui.KeyOf(tui.Left)] = toActions(actBackwardChar)
+	keymap[tui.KeyOf(tui.Right)] = toActions(actForwardChar)
+
+	keymap[tui.KeyOf(tui.Home)] = toActions(actBeginningOfLine)
+	keymap[tui.KeyOf(tui.End)] = toActions(actEndOfLine)
+	keymap[tui.KeyOf(tui.Del)] = toActions(actDeleteChar)
+	keymap[tui.KeyOf(tui.PgUp)] = toActions(actPageUp)
+	keymap[tui.KeyOf(tui.PgDn)] = toActions(actPageDown)
+
+	keymap[tui.KeyOf(tui.Rune)] = toActions(actRune)
+	keymap[tui.KeyOf(tui.Paste)] = toActions(actPaste)
+	keymap[tui.KeyOf(tui.Mouse)] = toActions(actMouse)
+	keymap[tui.KeyOf(tui.DoubleClick)] = toActions(actAccept)
+	keymap[tui.KeyOf(tui.LeftClick)] = toActions(actIgnore)
+	keymap[tui.KeyOf(tui.RightClick)] = toActions(actToggle)
 	return keymap
 }
 
@@ -289,14 +468,30 @@ func trimQuery(query string) []rune {
 	return []rune(strings.Replace(query, "\t", " ", -1))
 }
 
+// pastedQuery returns the pasted text with the line breaks and tabs replaced
+// with spaces and the other control characters removed
+func pastedQuery(text string) []rune {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return []rune(strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, text))
+}
+
 // NewTerminal returns new Terminal object
 func NewTerminal(opts *Options, eventBox *util.EventBox) *Terminal {
 	input := trimQuery(opts.Query)
 	var header []string
-	if opts.Reverse {
-		header = opts.Header
-	} else {
+	switch opts.Layout {
+	case layoutDefault, layoutReverseList:
 		header = reverseStringArray(opts.Header)
+	default:
+		header = opts.Header
 	}
 	var delay time.Duration
 	if opts.Tac {
@@ -334,7 +529,7 @@ func NewTerminal(opts *Options, eventBox *util.EventBox) *Terminal {
 			if previewBox != nil && (opts.Preview.position == posUp || opts.Preview.position == posDown) {
 				effectiveMinHeight *= 2
 			}
-			if opts.InlineInfo {
+			if opts.Info != infoDefault && len(opts.Separator) == 0 {
 				effectiveMinHeight -= 1
 			}
 			if opts.Bordered {
@@ -353,8 +548,11 @@ func NewTerminal(opts *Options, eventBox *util.EventBox) *Terminal {
 	}
 	t := Terminal{
 		initDelay:  delay,
-		inlineInfo: opts.InlineInfo,
-		reverse:    opts.Reverse,
+		info:       opts.Info,
+		separator:  opts.Separator,
+		scrollbar:  opts.Scrollbar,
+		dragging:   barNone,
+		layout:     opts.Layout,
 		fullscreen: fullscreen,
 		hscroll:    opts.Hscroll,
 		hscrollOff: opts.HscrollOff,
@@ -363,17 +561,30 @@ func NewTerminal(opts *Options, eventBox *util.EventBox) *Terminal {
 		cx:         len(input),
 		cy:         0,
 		offset:     0,
-		yanked:     []rune{},
+		promptText: opts.Prompt,
+		killRing:   [][]rune{},
+		undoStack:  []editState{},
+		redoStack:  []editState{},
 		input:      input,
 		multi:      opts.Multi,
 		sort:       opts.Sort > 0,
 		toggleSort: opts.ToggleSort,
+		track:      opts.Track,
+		follow:     opts.Follow,
+		followMark: -1,
+		newItems:   0,
 		delimiter:  opts.Delimiter,
 		expect:     opts.Expect,
 		keymap:     opts.Keymap,
+		sequences:  opts.Sequences,
+		pending:    []tui.Event{},
 		pressed:    "",
 		printQuery: opts.PrintQuery,
+		printOrder: opts.PrintOrder,
+		readZero:   opts.ReadZero,
+		outputFmt:  opts.OutputFmt,
 		history:    opts.History,
+		session:    opts.Session,
 		margin:     opts.Margin,
 		bordered:   opts.Bordered,
 		cleanExit:  opts.ClearOnExit,
@@ -383,6 +594,9 @@ func NewTerminal(opts *Options, eventBox *util.EventBox) *Terminal {
 		header0:    header,
 		ansi:       opts.Ansi,
 		tabstop:    opts.Tabstop,
+		tabular:    opts.Tabular,
+		tabularMax: opts.TabularMax,
+		columns:    []tabularColumn{},
 		reading:    true,
 		success:    true,
 		jumping:    jumpDisabled,
@@ -390,9 +604,11 @@ func NewTerminal(opts *Options, eventBox *util.EventBox) *Terminal {
 		printer:    opts.Printer,
 		merger:     EmptyMerger,
 		selected:   make(map[int32]selectedItem),
+		maxSelect:  opts.MaxSelect,
+		anchor:     -1,
 		reqBox:     util.NewEventBox(),
 		preview:    opts.Preview,
-		previewer:  previewer{"", 0, 0, previewBox != nil && !opts.Preview.hidden},
+		previewer:  previewer{"", 0, 0, previewBox != nil && !opts.Preview.hidden, -1, 0},
 		previewBox: previewBox,
 		eventBox:   eventBox,
 		mutex:      sync.Mutex{},
@@ -402,7 +618,18 @@ func NewTerminal(opts *Options, eventBox *util.EventBox) *Terminal {
 		startChan:  make(chan bool, 1),
 		tui:        renderer,
 		initFunc:   func() { renderer.Init() }}
-	t.prompt, t.promptLen = t.processTabs([]rune(opts.Prompt), 0)
+	if opts.KeymapStyle == keymapVi {
+		t.vi = &viState{mode: viInsert}
+	}
+	if opts.Gutter {
+		t.pointer, t.pointerLen = opts.Pointer, t.displayWidth([]rune(opts.Pointer))
+		t.marker, t.markerLen = opts.Marker, t.displayWidth([]rune(opts.Marker))
+	}
+	t.lineNumbers = opts.LineNumbers
+	if t.session != nil {
+		t.restore = newSessionRestore(t.session, t.multi)
+	}
+	t.updatePrompt()
 	return &t
 }
 
@@ -459,13 +686,168 @@ func (t *Terminal) UpdateProgress(progress float32) {
 // UpdateList updates Merger to display the list
 func (t *Terminal) UpdateList(merger *Merger) {
 	t.mutex.Lock()
+	if t.listMerger != nil {
+		// The result is displayed when the selected view is closed
+		t.listMerger = merger
+		t.progress = 100
+		t.mutex.Unlock()
+		t.reqBox.Set(reqInfo, nil)
+		return
+	}
+	var tracked *Item
+	if t.track || t.follow {
+		tracked = t.currentItem()
+	}
+	following := t.follow && !merger.sorted && !t.merger.sorted
+	atNewestEnd := following && t.atNewestEnd()
+	if following && !atNewestEnd && t.followMark < 0 && merger.pattern == t.merger.pattern {
+		// Items newer than the ones in the current list are counted as new
+		t.followMark = t.merger.newestIndex() + 1
+	}
 	t.progress = 100
 	t.merger = merger
+	if atNewestEnd {
+		t.followMark = -1
+		if merger.tac {
+			t.cy = 0
+			t.offset = 0
+		} else {
+			t.cy = util.Max(0, merger.Length()-1)
+		}
+	} else if tracked != nil {
+		t.focus(tracked)
+	}
+	if t.restore != nil && t.restore.focused != nil && t.focus(t.restore.focused) {
+		t.restore.focused = nil
+		if t.restore.done() {
+			t.restore = nil
+		}
+	}
+	t.newItems = 0
+	if following && t.followMark >= 0 {
+		t.newItems = merger.countNewer(t.followMark)
+	}
 	t.mutex.Unlock()
 	t.reqBox.Set(reqInfo, nil)
 	t.reqBox.Set(reqList, nil)
 }
 
+// RestoreSession selects the items of the saved session among the new items
+// in the chunks, and finds the item to focus. Items are matched by content.
+func (t *Terminal) RestoreSession(chunks []*Chunk) {
+	t.mutex.Lock()
+	r := t.restore
+	if r == nil {
+		t.mutex.Unlock()
+		return
+	}
+	idx := 0
+	restored := false
+	for _, chunk := range chunks {
+		if idx+chunk.count <= r.scanned {
+			idx += chunk.count
+			continue
+		}
+		for i := 0; i < chunk.count; i, idx = i+1, idx+1 {
+			if idx < r.scanned {
+				continue
+			}
+			item := &chunk.items[i]
+			str := item.AsString(t.ansi)
+			if order, found := r.selected[str]; found && !t.selectionFull() {
+				// Keep the order of the selection
+				t.selected[item.Index()] = selectedItem{r.start.Add(time.Duration(order[0])), item}
+				if len(order) > 1 {
+					r.selected[str] = order[1:]
+				} else {
+					delete(r.selected, str)
+				}
+				restored = true
+			}
+			if r.focus != nil && *r.focus == str {
+				r.focus = nil
+				r.focused = item
+			}
+		}
+	}
+	r.scanned = idx
+	if r.done() {
+		t.restore = nil
+	}
+	if restored {
+		t.version++
+		t.updateSelectedView()
+	}
+	t.mutex.Unlock()
+	if restored {
+		t.reqBox.Set(reqInfo, nil)
+		t.reqBox.Set(reqList, nil)
+	}
+}
+
+// saveSession saves the query, the selected items, and the current item to
+// the session file
+func (t *Terminal) saveSession() error {
+	t.session.query = string(t.input)
+	t.session.focus = nil
+	if current := t.currentItem(); current != nil {
+		str := current.AsString(t.ansi)
+		t.session.focus = &str
+	}
+	selected := []string{}
+	for _, sel := range t.sortSelected() {
+		selected = append(selected, sel.item.AsString(t.ansi))
+	}
+	if t.reading && t.restore != nil && len(t.restore.selected) > 0 {
+		// Items not read yet are still selected
+		pending := make([]string, len(t.session.selected))
+		found := make([]bool, len(t.session.selected))
+		for str, order := range t.restore.selected {
+			for _, idx := range order {
+				pending[idx] = str
+				found[idx] = true
+			}
+		}
+		for idx, str := range pending {
+			if found[idx] {
+				selected = append(selected, str)
+			}
+		}
+	}
+	t.session.selected = selected
+	return t.session.save()
+}
+
+// atNewestEnd returns true if the cursor is on the most recent item of the
+// unsorted list
+func (t *Terminal) atNewestEnd() bool {
+	count := t.merger.Length()
+	if count == 0 {
+		return true
+	}
+	if t.merger.tac {
+		return t.cy == 0
+	}
+	return t.cy == count-1
+}
+
+// focus moves the cursor to the given item while keeping its vertical
+// position on the screen. Returns false if the item is not in the list.
+func (t *Terminal) focus(item *Item) bool {
+	idx := t.merger.FindIndex(item.Index())
+	if idx < 0 {
+		return false
+	}
+	pos := t.cy - t.offset
+	t.cy = idx
+	if t.window != nil {
+		height := t.maxItems()
+		t.offset = util.Constrain(t.cy-pos, 0, util.Max(0, t.merger.Length()-height))
+		t.offset = util.Constrain(t.offset, t.cy-height+1, t.cy)
+	}
+	return true
+}
+
 func (t *Terminal) output() bool {
 	if t.printQuery {
 		t.printer(string(t.input))
@@ -473,21 +855,53 @@ func (t *Terminal) output() bool {
 	if len(t.expect) > 0 {
 		t.printer(t.pressed)
 	}
+	printItem := func(index int, item *Item) {
+		if len(t.outputFmt) > 0 {
+			t.printer(formatOutput(t.outputFmt, t.ansi, t.delimiter, string(t.input), t.pressed, index, item))
+		} else {
+			t.printer(item.AsString(t.ansi))
+		}
+	}
 	found := len(t.selected) > 0
 	if !found {
 		current := t.currentItem()
 		if current != nil {
-			t.printer(current.AsString(t.ansi))
+			printItem(0, current)
 			found = true
 		}
 	} else {
-		for _, sel := range t.sortSelected() {
-			t.printer(sel.item.AsString(t.ansi))
+		for idx, sel := range t.sortOutput() {
+			printItem(idx, sel.item)
 		}
 	}
 	return found
 }
 
+// sortOutput returns the selected items in the order given by --print-order.
+// With score order, the items in the order of the search result are followed
+// by the ones hidden by the query in the order of selection.
+func (t *Terminal) sortOutput() []selectedItem {
+	sels := t.sortSelected()
+	switch t.printOrder {
+	case printOrderIndex:
+		sort.Stable(byIndexOrder(sels))
+	case printOrderScore:
+		merger := t.merger
+		if t.listMerger != nil {
+			merger = t.listMerger
+		}
+		ranks := make(map[int32]int)
+		for i := 0; i < merger.Length() && len(ranks) < len(sels); i++ {
+			index := merger.Get(i).item.Index()
+			if _, found := t.selected[index]; found {
+				ranks[index] = i
+			}
+		}
+		sort.Stable(byRankOrder{sels, ranks})
+	}
+	return sels
+}
+
 func (t *Terminal) sortSelected() []selectedItem {
 	sels := make([]selectedItem, 0, len(t.selected))
 	for _, sel := range t.selected {
@@ -497,6 +911,105 @@ func (t *Terminal) sortSelected() []selectedItem {
 	return sels
 }
 
+// selectedMerger returns the Merger of the selected items in the order of
+// selection, or in the order of the input if viewByIndex is set
+func (t *Terminal) selectedMerger() *Merger {
+	sels := t.sortSelected()
+	if t.viewByIndex {
+		sort.Sort(byIndexOrder(sels))
+	}
+	results := make([]Result, len(sels))
+	for idx, sel := range sels {
+		results[idx] = Result{item: sel.item}
+	}
+	return NewMerger(nil, [][]Result{results}, false, false)
+}
+
+// toggleSelectedView switches the list between the search result and the
+// selected items
+func (t *Terminal) toggleSelectedView() {
+	current := t.currentItem()
+	if t.listMerger != nil {
+		t.merger = t.listMerger
+		t.listMerger = nil
+	} else {
+		t.listMerger = t.merger
+		t.viewVersion = t.version
+		t.merger = t.selectedMerger()
+	}
+	if current == nil || !t.focus(current) {
+		t.vset(0)
+	}
+}
+
+// updateSelectedView rebuilds the selected view if the selection has changed
+func (t *Terminal) updateSelectedView() {
+	if t.listMerger == nil || t.viewVersion == t.version {
+		return
+	}
+	t.viewVersion = t.version
+	t.merger = t.selectedMerger()
+	t.vset(t.cy)
+}
+
+// moveSelected swaps the current item with the next one in the order of
+// selection. The direction is the same as that of the cursor movement on the
+// selected view.
+func (t *Terminal) moveSelected(o int) {
+	current := t.currentItem()
+	if current == nil {
+		return
+	}
+	if _, found := t.selected[current.Index()]; !found {
+		return
+	}
+	if t.layout != layoutDefault {
+		o *= -1
+	}
+	sels := t.sortSelected()
+	for idx, sel := range sels {
+		if sel.item.Index() != current.Index() {
+			continue
+		}
+		if idx+o < 0 || idx+o >= len(sels) {
+			return
+		}
+		other := sels[idx+o]
+		t.selected[current.Index()] = selectedItem{other.at, current}
+		t.selected[other.item.Index()] = selectedItem{sel.at, other.item}
+		t.version++
+		break
+	}
+	if t.listMerger != nil && !t.viewByIndex {
+		t.updateSelectedView()
+		t.vset(t.merger.FindIndex(current.Index()))
+	}
+}
+
+// hiddenSelected returns the number of the selected items that are not in
+// the search result
+func (t *Terminal) hiddenSelected() int {
+	merger := t.merger
+	if t.listMerger != nil {
+		merger = t.listMerger
+	}
+	// Only recounted when the list or the selection is updated
+	if merger == t.hiddenMerger && t.version == t.hiddenVersion {
+		return t.hidden
+	}
+	t.hidden = 0
+	t.hiddenMerger = merger
+	t.hiddenVersion = t.version
+	if merger.pattern != nil {
+		for _, sel := range t.selected {
+			if result, _, _ := merger.pattern.MatchItem(sel.item, false, t.slab); result == nil {
+				t.hidden++
+			}
+		}
+	}
+	return t.hidden
+}
+
 func (t *Terminal) displayWidth(runes []rune) int {
 	l := 0
 	for _, r := range runes {
@@ -505,6 +1018,112 @@ func (t *Terminal) displayWidth(runes []rune) int {
 	return l
 }
 
+func tabularCells(text []rune, delimiter Delimiter) []tabularCell {
+	tokens := Tokenize(string(text), delimiter)
+	cells := make([]tabularCell, len(tokens))
+	for idx, token := range tokens {
+		begin := int(token.prefixLength)
+		next := begin + token.text.Length()
+		end := next
+		for end > begin && (text[end-1] == ' ' || text[end-1] == '\t') {
+			end--
+		}
+		cells[idx] = tabularCell{begin, end, next}
+	}
+	return cells
+}
+
+// updateColumns calculates the widths of the columns from the header and the
+// visible items. Returns true if they have changed.
+func (t *Terminal) updateColumns() bool {
+	columns := []tabularColumn{}
+	add := func(text []rune) {
+		cells := tabularCells(text, t.delimiter)
+		// The last field of each line is not padded
+		for idx := 0; idx < len(cells)-1; idx++ {
+			cell := cells[idx]
+			if idx >= len(columns) {
+				columns = append(columns, tabularColumn{})
+			}
+			width := t.displayWidth(text[cell.begin:cell.end])
+			if t.tabularMax > 0 {
+				width = util.Min(width, t.tabularMax)
+			}
+			columns[idx].width = util.Max(columns[idx].width, width)
+			if cell.end < cell.next {
+				columns[idx].gap = 1
+			}
+		}
+	}
+	for _, item := range t.headerItems() {
+		add(item.text.ToRunes())
+	}
+	count := util.Min(t.merger.Length()-t.offset, t.maxItems())
+	for i := 0; i < count; i++ {
+		add(t.merger.Get(i + t.offset).item.text.ToRunes())
+	}
+
+	changed := len(columns) != len(t.columns)
+	for idx := 0; !changed && idx < len(columns); idx++ {
+		changed = columns[idx] != t.columns[idx]
+	}
+	t.columns = columns
+	return changed
+}
+
+// tabulate pads the fields of the text to the widths of the columns. It also
+// returns the positions of the original runes in the new text.
+func (t *Terminal) tabulate(text []rune) ([]rune, []int32) {
+	cells := tabularCells(text, t.delimiter)
+	positions := make([]int32, len(text)+1)
+	output := make([]rune, 0, len(text))
+	prev := 0
+	for idx, cell := range cells {
+		// Leading whitespace is dropped
+		for ; prev < cell.begin; prev++ {
+			positions[prev] = int32(len(output))
+		}
+		if idx == len(cells)-1 || idx >= len(t.columns) {
+			break
+		}
+		column := t.columns[idx]
+		truncate := t.displayWidth(text[cell.begin:cell.end]) > column.width
+		limit := column.width
+		if truncate {
+			limit = util.Max(0, limit-2)
+		}
+		width := 0
+		for ; prev < cell.end; prev++ {
+			w := util.RuneWidth(text[prev], width, t.tabstop)
+			if truncate && width+w > limit {
+				break
+			}
+			positions[prev] = int32(len(output))
+			output = append(output, text[prev])
+			width += w
+		}
+		if truncate {
+			for ; prev < cell.end; prev++ {
+				positions[prev] = int32(len(output))
+			}
+			output = append(output, []rune("..")...)
+			width += 2
+		}
+		for ; prev < cell.next; prev++ {
+			positions[prev] = int32(len(output))
+		}
+		for ; width < column.width+column.gap; width++ {
+			output = append(output, ' ')
+		}
+	}
+	for ; prev < len(text); prev++ {
+		positions[prev] = int32(len(output))
+		output = append(output, text[prev])
+	}
+	positions[len(text)] = int32(len(output))
+	return output, positions
+}
+
 const (
 	minWidth  = 16
 	minHeight = 4
@@ -583,11 +1202,11 @@ func (t *Terminal) resizeWindows() {
 			marginInt[0]-1,
 			marginInt[3],
 			width,
-			height+2, tui.BorderHorizontal)
+			height+2, false, tui.BorderHorizontal)
 	}
 	if previewVisible {
 		createPreviewWindow := func(y int, x int, w int, h int) {
-			t.pborder = t.tui.NewWindow(y, x, w, h, tui.BorderAround)
+			t.pborder = t.tui.NewWindow(y, x, w, h, true, tui.BorderAround)
 			pwidth := w - 4
 			// ncurses auto-wraps the line when the cursor reaches the right-end of
 			// the window. To prevent unintended line-wraps, we use the width one
@@ -595,29 +1214,29 @@ func (t *Terminal) resizeWindows() {
 			if !t.preview.wrap && t.tui.DoesAutoWrap() {
 				pwidth += 1
 			}
-			t.pwindow = t.tui.NewWindow(y+1, x+2, pwidth, h-2, tui.BorderNone)
+			t.pwindow = t.tui.NewWindow(y+1, x+2, pwidth, h-2, true, tui.BorderNone)
 			os.Setenv("FZF_PREVIEW_HEIGHT", strconv.Itoa(h-2))
 		}
 		switch t.preview.position {
 		case posUp:
 			pheight := calculateSize(height, t.preview.size, minHeight, 3)
 			t.window = t.tui.NewWindow(
-				marginInt[0]+pheight, marginInt[3], width, height-pheight, tui.BorderNone)
+				marginInt[0]+pheight, marginInt[3], width, height-pheight, false, tui.BorderNone)
 			createPreviewWindow(marginInt[0], marginInt[3], width, pheight)
 		case posDown:
 			pheight := calculateSize(height, t.preview.size, minHeight, 3)
 			t.window = t.tui.NewWindow(
-				marginInt[0], marginInt[3], width, height-pheight, tui.BorderNone)
+				marginInt[0], marginInt[3], width, height-pheight, false, tui.BorderNone)
 			createPreviewWindow(marginInt[0]+height-pheight, marginInt[3], width, pheight)
 		case posLeft:
 			pwidth := calculateSize(width, t.preview.size, minWidth, 5)
 			t.window = t.tui.NewWindow(
-				marginInt[0], marginInt[3]+pwidth, width-pwidth, height, tui.BorderNone)
+				marginInt[0], marginInt[3]+pwidth, width-pwidth, height, false, tui.BorderNone)
 			createPreviewWindow(marginInt[0], marginInt[3], pwidth, height)
 		case posRight:
 			pwidth := calculateSize(width, t.preview.size, minWidth, 5)
 			t.window = t.tui.NewWindow(
-				marginInt[0], marginInt[3], width-pwidth, height, tui.BorderNone)
+				marginInt[0], marginInt[3], width-pwidth, height, false, tui.BorderNone)
 			createPreviewWindow(marginInt[0], marginInt[3]+width-pwidth, pwidth, height)
 		}
 	} else {
@@ -625,7 +1244,7 @@ func (t *Terminal) resizeWindows() {
 			marginInt[0],
 			marginInt[3],
 			width,
-			height, tui.BorderNone)
+			height, false, tui.BorderNone)
 	}
 	for i := 0; i < t.window.Height(); i++ {
 		t.window.MoveAndClear(i, 0)
@@ -633,9 +1252,57 @@ func (t *Terminal) resizeWindows() {
 	t.truncateQuery()
 }
 
+// noInfoLine returns true if the line below the prompt is not used for
+// displaying the finder info or the separator
+func (t *Terminal) noInfoLine() bool {
+	return t.info != infoDefault && len(t.separator) == 0
+}
+
+// infoOnPromptLine returns true if the finder info is displayed on the same
+// line as the prompt
+func (t *Terminal) infoOnPromptLine() bool {
+	return t.info == infoInline || t.info == infoRight
+}
+
+// listOffset returns the line number of the first item from the prompt line
+func (t *Terminal) listOffset() int {
+	n := 2 + len(t.header)
+	if t.noInfoLine() {
+		n--
+	}
+	return n
+}
+
+// screenToLine converts the vertical position in the window to the line
+// number counted from the prompt line. It is the inverse of move().
+func (t *Terminal) screenToLine(y int) int {
+	h := t.window.Height()
+	switch t.layout {
+	case layoutDefault:
+		return h - y - 1
+	case layoutReverseList:
+		n := t.listOffset()
+		if y < h-n {
+			return y + n
+		}
+		return h - y - 1
+	}
+	return y
+}
+
 func (t *Terminal) move(y int, x int, clear bool) {
-	if !t.reverse {
-		y = t.window.Height() - y - 1
+	h := t.window.Height()
+
+	switch t.layout {
+	case layoutDefault:
+		y = h - y - 1
+	case layoutReverseList:
+		n := t.listOffset()
+		if y < n {
+			y = h - y - 1
+		} else {
+			y -= n
+		}
 	}
 
 	if clear {
@@ -649,15 +1316,81 @@ func (t *Terminal) placeCursor() {
 	t.move(0, t.promptLen+t.displayWidth(t.input[:t.cx]), false)
 }
 
+func (t *Terminal) updatePrompt() {
+	prompt := t.promptText
+	if t.vi != nil {
+		prompt = viIndicators[t.vi.mode] + prompt
+	}
+	t.prompt, t.promptLen = t.processTabs([]rune(prompt), 0)
+}
+
 func (t *Terminal) printPrompt() {
 	t.move(0, 0, true)
 	t.window.CPrint(tui.ColPrompt, t.strong, t.prompt)
-	t.window.CPrint(tui.ColNormal, t.strong, string(t.input))
+	color := tui.ColQuery
+	if t.jumping != jumpDisabled {
+		// The query cannot be edited while choosing a jump label
+		color = tui.ColDisabled
+	}
+	t.window.CPrint(color, t.strong, string(t.input))
 }
 
 func (t *Terminal) printInfo() {
+	output := fmt.Sprintf("%d/%d", t.merger.Length(), t.count)
+	if t.toggleSort {
+		if t.sort {
+			output += " +S"
+		} else {
+			output += " -S"
+		}
+	}
+	if t.track {
+		output += " +T"
+	}
+	if t.newItems > 0 {
+		output += fmt.Sprintf(" (+%d new)", t.newItems)
+	}
+	if names := t.pendingNames(); len(names) > 0 {
+		output += " [" + strings.Join(names, " ") + "]"
+	}
+	if t.listMerger != nil {
+		if t.viewByIndex {
+			output += " [selected by index]"
+		} else {
+			output += " [selected]"
+		}
+	}
+	if t.multi && (t.maxSelect > 0 || len(t.selected) > 0) {
+		selected := strconv.Itoa(len(t.selected))
+		if t.maxSelect > 0 {
+			selected += "/" + strconv.Itoa(t.maxSelect)
+		}
+		if hidden := t.hiddenSelected(); hidden > 0 {
+			selected += fmt.Sprintf(", %d hidden", hidden)
+		}
+		output += " (" + selected + ")"
+	}
+	if t.progress > 0 && t.progress < 100 {
+		output += fmt.Sprintf(" (%d%%)", t.progress)
+	}
+	if !t.success && t.count == 0 {
+		if len(os.Getenv("FZF_DEFAULT_COMMAND")) > 0 {
+			output = "[$FZF_DEFAULT_COMMAND failed]"
+		} else {
+			output = "[default command failed - $FZF_DEFAULT_COMMAND required]"
+		}
+	}
+
+	if t.info != infoDefault && len(t.separator) > 0 {
+		t.move(1, 0, true)
+		t.printSeparator(0)
+	}
+
 	pos := 0
-	if t.inlineInfo {
+	switch t.info {
+	case infoHidden:
+		return
+	case infoInline:
 		pos = t.promptLen + t.displayWidth(t.input) + 1
 		if pos+len(" < ") > t.window.Width() {
 			return
@@ -669,41 +1402,57 @@ func (t *Terminal) printInfo() {
 			t.window.CPrint(tui.ColPrompt, t.strong, " < ")
 		}
 		pos += len(" < ")
-	} else {
+	case infoRight:
+		pos = t.window.Width() - len(output) - 2
+		if pos <= t.promptLen+t.displayWidth(t.input) {
+			return
+		}
+		t.move(0, pos, true)
+		if t.reading {
+			t.window.CPrint(tui.ColSpinner, t.strong, t.spinner())
+		}
+		t.move(0, pos+2, false)
+		pos += 2
+	default:
 		t.move(1, 0, true)
 		if t.reading {
-			duration := int64(spinnerDuration)
-			idx := (time.Now().UnixNano() % (duration * int64(len(_spinner)))) / duration
-			t.window.CPrint(tui.ColSpinner, t.strong, _spinner[idx])
+			t.window.CPrint(tui.ColSpinner, t.strong, t.spinner())
 		}
 		t.move(1, 2, false)
 		pos = 2
 	}
 
-	output := fmt.Sprintf("%d/%d", t.merger.Length(), t.count)
-	if t.toggleSort {
-		if t.sort {
-			output += " +S"
-		} else {
-			output += " -S"
+	if pos+len(output) <= t.window.Width() {
+		t.window.CPrint(tui.ColInfo, 0, output)
+		pos += len(output)
+		if len(t.failure) > 0 && time.Since(t.failureAt) < failureDuration {
+			failure, _ := t.trimRight([]rune(" "+t.failure), t.window.Width()-pos)
+			t.window.CPrint(tui.ColError, 0, string(failure))
+			pos += t.displayWidth(failure)
 		}
-	}
-	if t.multi && len(t.selected) > 0 {
-		output += fmt.Sprintf(" (%d)", len(t.selected))
-	}
-	if t.progress > 0 && t.progress < 100 {
-		output += fmt.Sprintf(" (%d%%)", t.progress)
-	}
-	if !t.success && t.count == 0 {
-		if len(os.Getenv("FZF_DEFAULT_COMMAND")) > 0 {
-			output = "[$FZF_DEFAULT_COMMAND failed]"
-		} else {
-			output = "[default command failed - $FZF_DEFAULT_COMMAND required]"
+		if t.info == infoDefault && len(t.separator) > 0 {
+			t.window.Print(" ")
+			t.printSeparator(pos + 1)
 		}
 	}
-	if pos+len(output) <= t.window.Width() {
-		t.window.CPrint(tui.ColInfo, 0, output)
+}
+
+func (t *Terminal) spinner() string {
+	duration := int64(spinnerDuration)
+	idx := (time.Now().UnixNano() % (duration * int64(len(_spinner)))) / duration
+	return _spinner[idx]
+}
+
+// printSeparator fills the rest of the current line, starting from the given
+// column, with the separator string
+func (t *Terminal) printSeparator(pos int) {
+	width := t.window.Width() - pos
+	sepWidth := t.displayWidth([]rune(t.separator))
+	if width <= 0 || sepWidth == 0 {
+		return
 	}
+	line, _ := t.trimRight([]rune(strings.Repeat(t.separator, width/sepWidth+1)), width)
+	t.window.CPrint(tui.ColSeparator, tui.AttrRegular, string(line))
 }
 
 func (t *Terminal) printHeader() {
@@ -711,43 +1460,56 @@ func (t *Terminal) printHeader() {
 		return
 	}
 	max := t.window.Height()
-	var state *ansiState
-	for idx, lineStr := range t.header {
+	for idx, item := range t.headerItems() {
 		line := idx + 2
-		if t.inlineInfo {
+		if t.noInfoLine() {
 			line--
 		}
 		if line >= max {
 			continue
 		}
+		t.move(line, t.gutterWidth(), true)
+		t.printHighlighted(Result{item: item},
+			tui.AttrRegular, tui.ColHeader, tui.ColHeader, false, false)
+	}
+}
+
+func (t *Terminal) headerItems() []*Item {
+	items := make([]*Item, len(t.header))
+	var state *ansiState
+	for idx, lineStr := range t.header {
 		trimmed, colors, newState := extractColor(lineStr, state, nil)
 		state = newState
-		item := &Item{
+		items[idx] = &Item{
 			text:   util.ToChars([]byte(trimmed)),
 			colors: colors}
-
-		t.move(line, 2, true)
-		t.printHighlighted(Result{item: item},
-			tui.AttrRegular, tui.ColHeader, tui.ColHeader, false, false)
 	}
+	return items
 }
 
 func (t *Terminal) printList() {
 	t.constrain()
+	resized := t.updateNumberLen()
+	if t.tabular && t.updateColumns() || resized {
+		// Force redraw of the lines
+		for i := range t.prevLines {
+			t.prevLines[i].result = Result{}
+		}
+		t.printHeader()
+	}
 
 	maxy := t.maxItems()
 	count := t.merger.Length() - t.offset
+	barLength, barStart := t.getScrollbar()
 	for j := 0; j < maxy; j++ {
 		i := j
-		if !t.reverse {
+		if t.layout == layoutDefault {
 			i = maxy - 1 - j
 		}
-		line := i + 2 + len(t.header)
-		if t.inlineInfo {
-			line--
-		}
+		line := i + t.listOffset()
 		if i < count {
-			t.printItem(t.merger.Get(i+t.offset), line, i, i == t.cy-t.offset)
+			bar := i >= barStart && i < barStart+barLength
+			t.printItem(t.merger.Get(i+t.offset), line, i, i == t.cy-t.offset, bar)
 		} else if t.prevLines[i] != emptyLine {
 			t.prevLines[i] = emptyLine
 			t.move(line, 0, true)
@@ -755,54 +1517,210 @@ func (t *Terminal) printList() {
 	}
 }
 
-func (t *Terminal) printItem(result Result, line int, i int, current bool) {
-	item := result.item
-	_, selected := t.selected[item.Index()]
-	label := " "
-	if t.jumping != jumpDisabled {
-		if i < len(t.jumpLabels) {
-			// Striped
-			current = i%2 == 0
-			label = t.jumpLabels[i : i+1]
-		}
-	} else if current {
-		label = ">"
+func (t *Terminal) printItem(result Result, line int, i int, current bool, bar bool) {
+	item := result.item
+	_, selected := t.selected[item.Index()]
+	label := ""
+	if t.jumping != jumpDisabled {
+		if i < len(t.jumpLabels) {
+			// Striped
+			current = i%2 == 0
+			label = t.jumpLabels[i : i+1]
+		}
+	} else if current {
+		label = t.pointer
+	}
+
+	// Avoid unnecessary redraw
+	newLine := itemLine{current: current, selected: selected, label: label,
+		result: result, queryLen: len(t.input), width: 0, bar: bar}
+	prevLine := t.prevLines[i]
+	if prevLine.current == newLine.current &&
+		prevLine.selected == newLine.selected &&
+		prevLine.label == newLine.label &&
+		prevLine.queryLen == newLine.queryLen &&
+		prevLine.bar == newLine.bar &&
+		prevLine.result == newLine.result {
+		return
+	}
+
+	t.move(line, 0, false)
+	if t.pointerLen > 0 {
+		color := tui.ColGutter
+		if current {
+			color = tui.ColCursor
+		}
+		t.window.CPrint(color, t.strong, t.padGutter(label, t.pointerLen))
+	}
+	if t.markerLen > 0 {
+		if selected {
+			t.window.CPrint(tui.ColSelected, t.strong, t.marker)
+		} else if current {
+			t.window.CPrint(tui.ColCurrent, t.strong, strings.Repeat(" ", t.markerLen))
+		} else {
+			t.window.Print(strings.Repeat(" ", t.markerLen))
+		}
+	}
+	if t.numberLen > 0 {
+		number := strconv.Itoa(int(item.Index()))
+		number = strings.Repeat(" ", t.numberLen-len(number)-1) + number + " "
+		if current {
+			t.window.CPrint(tui.ColCurrent, 0, number)
+		} else {
+			t.window.CPrint(tui.ColInfo, 0, number)
+		}
+	}
+	if current {
+		newLine.width = t.printHighlighted(result, t.strong, tui.ColCurrent, tui.ColCurrentMatch, true, true)
+	} else if selected && t.markerLen == 0 {
+		// Without the marker, selected items are distinguished by the color
+		newLine.width = t.printHighlighted(result, t.strong, tui.ColSelected, tui.ColMatch, false, true)
+	} else {
+		newLine.width = t.printHighlighted(result, 0, tui.ColNormal, tui.ColMatch, false, true)
+	}
+	fillSpaces := prevLine.width - newLine.width
+	if fillSpaces > 0 {
+		t.window.Print(strings.Repeat(" ", fillSpaces))
+	}
+	if t.pointerLen == 0 && t.jumping != jumpDisabled && len(label) > 0 {
+		// Overlay the jump label on the first column
+		t.move(line, 0, false)
+		t.window.CPrint(tui.ColCursor, t.strong, label)
+	}
+	if len(t.scrollbar) > 0 {
+		t.move(line, t.window.Width()-1, false)
+		if bar {
+			t.window.CPrint(tui.ColScrollbar, tui.AttrRegular, t.scrollbar)
+		} else {
+			t.window.Print(" ")
+		}
+	}
+	t.prevLines[i] = newLine
+}
+
+// gutterWidth returns the width of the pointer, the marker, and the line
+// number columns on the left of the list
+func (t *Terminal) gutterWidth() int {
+	return t.pointerLen + t.markerLen + t.numberLen
+}
+
+// updateNumberLen updates the width of the column of --line-numbers for the
+// largest index of the items. Returns true if the width has changed.
+func (t *Terminal) updateNumberLen() bool {
+	if !t.lineNumbers {
+		return false
+	}
+	numberLen := len(strconv.Itoa(util.Max(t.count-1, 0))) + 1
+	if numberLen == t.numberLen {
+		return false
+	}
+	t.numberLen = numberLen
+	return true
+}
+
+// padGutter pads the text in the gutter with spaces to fill the width
+func (t *Terminal) padGutter(text string, width int) string {
+	if pad := width - t.displayWidth([]rune(text)); pad > 0 {
+		return text + strings.Repeat(" ", pad)
+	}
+	return text
+}
+
+// calculateScrollbar returns the length of the scrollbar and its starting
+// position for a view of the given size scrolled by offset
+func calculateScrollbar(total int, size int, offset int) (int, int) {
+	if total <= size || size <= 0 {
+		return 0, 0
+	}
+	barLength := util.Max(1, size*size/total)
+	barStart := (size - barLength) * offset / (total - size)
+	return barLength, util.Constrain(barStart, 0, size-barLength)
+}
+
+func (t *Terminal) getScrollbar() (int, int) {
+	if len(t.scrollbar) == 0 {
+		return 0, 0
 	}
+	return calculateScrollbar(t.merger.Length(), t.maxItems(), t.offset)
+}
 
-	// Avoid unnecessary redraw
-	newLine := itemLine{current: current, selected: selected, label: label,
-		result: result, queryLen: len(t.input), width: 0}
-	prevLine := t.prevLines[i]
-	if prevLine.current == newLine.current &&
-		prevLine.selected == newLine.selected &&
-		prevLine.label == newLine.label &&
-		prevLine.queryLen == newLine.queryLen &&
-		prevLine.result == newLine.result {
-		return
+func (t *Terminal) getPreviewScrollbar() (int, int) {
+	if len(t.scrollbar) == 0 {
+		return 0, 0
 	}
+	return calculateScrollbar(t.previewer.lines, t.pwindow.Height(), t.previewer.offset)
+}
 
-	t.move(line, 0, false)
-	t.window.CPrint(tui.ColCursor, t.strong, label)
-	if current {
-		if selected {
-			t.window.CPrint(tui.ColSelected, t.strong, ">")
+// printPreviewScrollbar draws the scrollbar of the preview window on the
+// padding column on the right of the window
+func (t *Terminal) printPreviewScrollbar() {
+	if len(t.scrollbar) == 0 {
+		return
+	}
+	barLength, barStart := t.getPreviewScrollbar()
+	x := t.pborder.Width() - 2
+	for i := 0; i < t.pwindow.Height(); i++ {
+		t.pborder.Move(i+1, x)
+		if i >= barStart && i < barStart+barLength {
+			t.pborder.CPrint(tui.ColScrollbar, tui.AttrRegular, t.scrollbar)
 		} else {
-			t.window.CPrint(tui.ColCurrent, t.strong, " ")
+			t.pborder.Print(" ")
 		}
-		newLine.width = t.printHighlighted(result, t.strong, tui.ColCurrent, tui.ColCurrentMatch, true, true)
-	} else {
-		if selected {
-			t.window.CPrint(tui.ColSelected, t.strong, ">")
-		} else {
-			t.window.Print(" ")
+	}
+}
+
+// scrollbarAt returns the scrollbar at the given position on the screen
+func (t *Terminal) scrollbarAt(y int, x int) scrollbarTarget {
+	if len(t.scrollbar) == 0 {
+		return barNone
+	}
+	if t.window.Enclose(y, x) && x == t.window.Left()+t.window.Width()-1 {
+		line := t.screenToLine(y-t.window.Top()) - t.listOffset()
+		if barLength, _ := t.getScrollbar(); barLength > 0 && line >= 0 && line < t.maxItems() {
+			return barList
 		}
-		newLine.width = t.printHighlighted(result, 0, tui.ColNormal, tui.ColMatch, false, true)
 	}
-	fillSpaces := prevLine.width - newLine.width
-	if fillSpaces > 0 {
-		t.window.Print(strings.Repeat(" ", fillSpaces))
+	if t.hasPreviewWindow() && x == t.pborder.Left()+t.pborder.Width()-2 &&
+		y >= t.pwindow.Top() && y < t.pwindow.Top()+t.pwindow.Height() {
+		if barLength, _ := t.getPreviewScrollbar(); barLength > 0 {
+			return barPreview
+		}
+	}
+	return barNone
+}
+
+// scrollTo scrolls the list or the preview window so that the center of the
+// scrollbar is placed at the given vertical position on the screen
+func (t *Terminal) scrollTo(target scrollbarTarget, y int) {
+	switch target {
+	case barList:
+		y = util.Constrain(y-t.window.Top(), 0, t.window.Height()-1)
+		if t.layout == layoutReverseList {
+			y = util.Min(y, t.maxItems()-1)
+		}
+		total := t.merger.Length()
+		size := t.maxItems()
+		barLength, _ := t.getScrollbar()
+		if barLength == 0 {
+			return
+		}
+		line := t.screenToLine(y) - t.listOffset()
+		offset := (line - barLength/2) * (total - size) / util.Max(1, size-barLength)
+		t.offset = util.Constrain(offset, 0, total-size)
+		t.cy = util.Constrain(t.cy, t.offset, t.offset+size-1)
+	case barPreview:
+		if !t.hasPreviewWindow() {
+			return
+		}
+		size := t.pwindow.Height()
+		barLength, _ := t.getPreviewScrollbar()
+		if barLength == 0 {
+			return
+		}
+		line := util.Constrain(y-t.pwindow.Top(), 0, size-1)
+		offset := (line - barLength/2) * (t.previewer.lines - size) / util.Max(1, size-barLength)
+		t.previewer.offset = util.Constrain(offset, 0, t.previewer.lines-size)
 	}
-	t.prevLines[i] = newLine
 }
 
 func (t *Terminal) trimRight(runes []rune, width int) ([]rune, int) {
@@ -876,7 +1794,25 @@ func (t *Terminal) printHighlighted(result Result, attr tui.Attr, col1 tui.Color
 	}
 
 	offsets := result.colorOffsets(charOffsets, t.theme, col2, attr, current)
-	maxWidth := t.window.Width() - 3
+	if t.tabular {
+		var positions []int32
+		text, positions = t.tabulate(text)
+		maxOffset := int32(len(positions) - 1)
+		mapRange := func(b int32, e int32) (int32, int32) {
+			b = util.Constrain32(b, 0, maxOffset)
+			e = util.Constrain32(e, 0, maxOffset)
+			if e > b {
+				return positions[b], positions[e-1] + 1
+			}
+			return positions[b], positions[b]
+		}
+		for idx, offset := range offsets {
+			offsets[idx].offset[0], offsets[idx].offset[1] = mapRange(offset.offset[0], offset.offset[1])
+		}
+		_, e := mapRange(0, int32(maxe))
+		maxe = int(e)
+	}
+	maxWidth := t.window.Width() - t.gutterWidth() - 1
 	maxe = util.Constrain(maxe+util.Min(maxWidth/2-2, t.hscrollOff), 0, len(text))
 	displayWidth := t.displayWidthWithLimit(text, 0, maxWidth)
 	if displayWidth > maxWidth {
@@ -990,10 +1926,12 @@ func (t *Terminal) printPreview() {
 					trimmed, _ = t.trimRight(trimmed, maxWidth-t.pwindow.X())
 				}
 				str, _ = t.processTabs(trimmed, 0)
-				if t.theme != nil && ansi != nil && ansi.colored() {
+				if t.theme != nil && t.previewer.errLine >= 0 && lineNo+t.previewer.offset > t.previewer.errLine {
+					fillRet = t.pwindow.CFill(tui.ColError.Fg(), tui.ColPreview.Bg(), tui.ColError.Attr(), str)
+				} else if t.theme != nil && ansi != nil && ansi.colored() {
 					fillRet = t.pwindow.CFill(ansi.fg, ansi.bg, ansi.attr, str)
 				} else {
-					fillRet = t.pwindow.CFill(tui.ColNormal.Fg(), tui.ColNormal.Bg(), tui.AttrRegular, str)
+					fillRet = t.pwindow.CFill(tui.ColPreview.Fg(), tui.ColPreview.Bg(), tui.ColPreview.Attr(), str)
 				}
 				return fillRet == tui.FillContinue
 			})
@@ -1019,6 +1957,30 @@ func (t *Terminal) printPreview() {
 		t.pwindow.Move(0, pos)
 		t.pwindow.CPrint(tui.ColInfo, tui.Reverse, offset)
 	}
+	t.printPreviewScrollbar()
+	t.printPreviewStatus()
+}
+
+// printPreviewStatus marks the top border of the preview window if the
+// preview command failed
+func (t *Terminal) printPreviewStatus() {
+	width := t.pborder.Width() - 2
+	if width <= 0 {
+		return
+	}
+	t.pborder.Move(0, 1)
+	t.pborder.CPrint(tui.ColPreviewBorder, tui.AttrRegular, strings.Repeat("─", width))
+	if t.previewer.status == 0 {
+		return
+	}
+	label := " failed "
+	if t.previewer.status > 0 {
+		label = fmt.Sprintf(" exit %d ", t.previewer.status)
+	}
+	if len(label)+2 <= width {
+		t.pborder.Move(0, 2)
+		t.pborder.CPrint(tui.ColError, tui.AttrRegular, label)
+	}
 }
 
 func (t *Terminal) processTabs(runes []rune, prefixWidth int) (string, int) {
@@ -1097,18 +2059,149 @@ func copySlice(slice []rune) []rune {
 	return ret
 }
 
+// recordEdit pushes the state of the query before the edit to the undo stack
+func (t *Terminal) recordEdit(state editState) {
+	t.undoStack = append(t.undoStack, state)
+	if len(t.undoStack) > maxUndo {
+		t.undoStack = t.undoStack[1:]
+	}
+	t.redoStack = t.redoStack[:0]
+}
+
+// beginEdit saves the state of the query before processing an event
+func (t *Terminal) beginEdit() *queryEdit {
+	edit := &queryEdit{before: editState{copySlice(t.input), t.cx}}
+	if t.vi != nil {
+		edit.mode = t.vi.mode
+		edit.grouped = t.vi.grouped
+	}
+	return edit
+}
+
+// keyActions returns the actions bound to the key of the event. With vi
+// keymap, the event is interpreted as a vi command if possible.
+func (t *Terminal) keyActions(event tui.Event) []action {
+	key := event.Key()
+	actions, prs := t.keymap[key]
+	if legacy, ok := tui.LegacyKey(key); !prs && ok {
+		actions, prs = t.keymap[legacy]
+	}
+	if !prs && key.Type == tui.Rune && key.Mod == 0 {
+		actions = t.keymap[tui.KeyOf(tui.Rune)]
+	}
+	if t.vi != nil {
+		if viActions, handled := t.viKey(event); handled {
+			actions = viActions
+		}
+	}
+	return actions
+}
+
+// editQuery performs the action if it inserts text to the query or undoes the
+// edit. Returns false for the other actions.
+func (t *Terminal) editQuery(a action, event tui.Event, edit *queryEdit) bool {
+	switch a.t {
+	case actRune:
+		prefix := copySlice(t.input[:t.cx])
+		t.input = append(append(prefix, event.Char), t.input[t.cx:]...)
+		t.cx++
+		edit.inserted = true
+	case actYank:
+		if len(t.killRing) > 0 {
+			t.yank(len(t.killRing)-1, false)
+			edit.yanked = true
+		}
+	case actYankPop:
+		if t.yanking && len(t.killRing) > 1 {
+			t.yank((t.yankIndex+len(t.killRing)-1)%len(t.killRing), true)
+			edit.yanked = true
+		}
+	case actUndo:
+		t.undo()
+		edit.undone = true
+	case actRedo:
+		t.redo()
+		edit.undone = true
+	default:
+		return false
+	}
+	return true
+}
+
+// endEdit records the edit of the query to the undo stack. Returns true if the
+// query is changed.
+func (t *Terminal) endEdit(edit *queryEdit) bool {
+	t.viConstrainCursor()
+	changed := string(edit.before.input) != string(t.input)
+	if changed && !edit.undone && !edit.grouped && !(edit.inserted && t.inserting) {
+		// Consecutive character inserts are undone together
+		t.recordEdit(edit.before)
+		if t.vi != nil && t.vi.mode == viInsert {
+			t.vi.grouped = true
+		}
+	}
+	t.inserting = edit.inserted && changed
+	t.yanking = edit.yanked
+	return changed
+}
+
+func (t *Terminal) undo() {
+	if len(t.undoStack) > 0 {
+		t.redoStack = append(t.redoStack, editState{copySlice(t.input), t.cx})
+		state := t.undoStack[len(t.undoStack)-1]
+		t.undoStack = t.undoStack[:len(t.undoStack)-1]
+		t.input, t.cx = state.input, state.cx
+	}
+}
+
+func (t *Terminal) redo() {
+	if len(t.redoStack) > 0 {
+		t.undoStack = append(t.undoStack, editState{copySlice(t.input), t.cx})
+		state := t.redoStack[len(t.redoStack)-1]
+		t.redoStack = t.redoStack[:len(t.redoStack)-1]
+		t.input, t.cx = state.input, state.cx
+	}
+}
+
 func (t *Terminal) rubout(pattern string) {
 	pcx := t.cx
 	after := t.input[t.cx:]
 	t.cx = findLastMatch(pattern, string(t.input[:t.cx])) + 1
-	t.yanked = copySlice(t.input[t.cx:pcx])
+	t.kill(t.input[t.cx:pcx])
 	t.input = append(t.input[:t.cx], after...)
 }
 
-func keyMatch(key int, event tui.Event) bool {
-	return event.Type == key ||
-		event.Type == tui.Rune && int(event.Char) == key-tui.AltZ ||
-		event.Type == tui.Mouse && key == tui.DoubleClick && event.MouseEvent.Double
+// kill pushes the text to the kill ring
+func (t *Terminal) kill(text []rune) {
+	if len(text) == 0 {
+		return
+	}
+	t.killRing = append(t.killRing, copySlice(text))
+	if len(t.killRing) > maxKillRing {
+		t.killRing = t.killRing[1:]
+	}
+}
+
+// lastKill returns the most recently killed text
+func (t *Terminal) lastKill() []rune {
+	if len(t.killRing) == 0 {
+		return []rune{}
+	}
+	return t.killRing[len(t.killRing)-1]
+}
+
+// yank inserts the text in the kill ring at the index. If the previous action
+// was yank or yank-pop, the previously yanked text is replaced.
+func (t *Terminal) yank(index int, replace bool) {
+	from := t.cx
+	if replace {
+		from = util.Constrain(t.yankFrom, 0, t.cx)
+	}
+	text := t.killRing[index]
+	t.input = append(append(copySlice(t.input[:from]), text...), t.input[t.cx:]...)
+	t.cx = from + len(text)
+	t.yankFrom = from
+	t.yankIndex = index
 }
 
 func quoteEntryCmd(entry string) string {
@@ -1139,7 +2232,64 @@ func hasPlusFlag(template string) bool {
 	return false
 }
 
-func replacePlaceholder(template string, stripAnsi bool, delimiter Delimiter, forcePlus bool, query string, allItems []*Item) string {
+// tempFiles holds the temporary files created for the placeholder
+// expressions with f flag, which are removed after the command finishes
+type tempFiles struct {
+	sep   string
+	paths []string
+}
+
+// write writes the values to a new temporary file, each followed by the
+// separator, and returns the path of the file
+func (f *tempFiles) write(values []string) (string, error) {
+	file, err := ioutil.TempFile("", "fzf-")
+	if err != nil {
+		return "", err
+	}
+	f.paths = append(f.paths, file.Name())
+	var data bytes.Buffer
+	for _, value := range values {
+		data.WriteString(value)
+		data.WriteString(f.sep)
+	}
+	_, err = file.Write(data.Bytes())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return file.Name(), err
+}
+
+func (f *tempFiles) remove() {
+	for _, path := range f.paths {
+		os.Remove(path)
+	}
+	f.paths = nil
+}
+
+// replacePlaceholder returns the command for the template. The expressions
+// with f flag, such as {+f}, are replaced to the paths of the temporary files
+// holding the values, which are created in files. They are left as they are
+// if files is nil.
+func replacePlaceholder(template string, stripAnsi bool, delimiter Delimiter, forcePlus bool, query string, allItems []*Item, files *tempFiles) string {
+	named := map[string]string{"{q}": quoteEntry(query)}
+	return expandPlaceholder(placeholder, template, stripAnsi, delimiter, forcePlus, quoteEntry, named, allItems, files)
+}
+
+// formatOutput returns the output line for the item with the --output-format
+// template. Unlike in the commands, the values are not quoted. {k} is the key
+// pressed to complete fzf, and {i} is the zero-based position of the item in
+// the output.
+func formatOutput(template string, stripAnsi bool, delimiter Delimiter, query string, key string, index int, item *Item) string {
+	named := map[string]string{"{q}": query, "{k}": key, "{i}": strconv.Itoa(index)}
+	noQuote := func(str string) string { return str }
+	return expandPlaceholder(outputPlaceholder, template, stripAnsi, delimiter, false, noQuote, named, []*Item{item, item}, nil)
+}
+
+// expandPlaceholder replaces the placeholder expressions in the template
+// found by the regular expression. The values for the named placeholders
+// such as {q} are given in the map.
+func expandPlaceholder(pattern *regexp.Regexp, template string, stripAnsi bool, delimiter Delimiter, forcePlus bool,
+	quote func(string) string, named map[string]string, allItems []*Item, files *tempFiles) string {
 	current := allItems[:1]
 	selected := allItems[1:]
 	if current[0] == nil {
@@ -1148,66 +2298,100 @@ func replacePlaceholder(template string, stripAnsi bool, delimiter Delimiter, fo
 	if selected[0] == nil {
 		selected = []*Item{}
 	}
-	return placeholder.ReplaceAllStringFunc(template, func(match string) string {
+	return pattern.ReplaceAllStringFunc(template, func(match string) string {
 		// Escaped pattern
 		if match[0] == '\\' {
 			return match[1:]
 		}
 
-		// Current query
-		if match == "{q}" {
-			return quoteEntry(query)
+		// Current query, and the others
+		if value, found := named[match]; found {
+			return value
 		}
 
+		expr := match
 		plusFlag := forcePlus
-		if match[1] == '+' {
-			match = "{" + match[2:]
+		if expr[1] == '+' {
+			expr = "{" + expr[2:]
 			plusFlag = true
 		}
+		fileFlag := false
+		if expr[1] == 'f' {
+			if files == nil {
+				return match
+			}
+			expr = "{" + expr[2:]
+			fileFlag = true
+		}
 		items := current
 		if plusFlag {
 			items = selected
 		}
 
-		replacements := make([]string, len(items))
+		values := make([]string, len(items))
+		quoted := true
+		if expr == "{n}" {
+			// Indexes of the items in the input
+			for idx, item := range items {
+				values[idx] = strconv.Itoa(int(item.Index()))
+			}
+			quoted = false
+		} else if expr == "{}" {
+			for idx, item := range items {
+				values[idx] = item.AsString(stripAnsi)
+			}
+		} else {
+			tokens := strings.Split(expr[1:len(expr)-1], ",")
+			ranges := make([]Range, len(tokens))
+			for idx, s := range tokens {
+				r, ok := ParseRange(&s)
+				if !ok {
+					// Invalid expression, just return the original string in the template
+					return match
+				}
+				ranges[idx] = r
+			}
 
-		if match == "{}" {
 			for idx, item := range items {
-				replacements[idx] = quoteEntry(item.AsString(stripAnsi))
+				tokens := Tokenize(item.AsString(stripAnsi), delimiter)
+				trans := Transform(tokens, ranges)
+				str := string(joinTokens(trans))
+				if delimiter.str != nil {
+					str = strings.TrimSuffix(str, *delimiter.str)
+				} else if delimiter.regex != nil {
+					delims := delimiter.regex.FindAllStringIndex(str, -1)
+					if len(delims) > 0 && delims[len(delims)-1][1] == len(str) {
+						str = str[:delims[len(delims)-1][0]]
+					}
+				}
+				values[idx] = strings.TrimSpace(str)
 			}
-			return strings.Join(replacements, " ")
 		}
 
-		tokens := strings.Split(match[1:len(match)-1], ",")
-		ranges := make([]Range, len(tokens))
-		for idx, s := range tokens {
-			r, ok := ParseRange(&s)
-			if !ok {
-				// Invalid expression, just return the original string in the template
-				return match
-			}
-			ranges[idx] = r
-		}
-
-		for idx, item := range items {
-			tokens := Tokenize(item.AsString(stripAnsi), delimiter)
-			trans := Transform(tokens, ranges)
-			str := string(joinTokens(trans))
-			if delimiter.str != nil {
-				str = strings.TrimSuffix(str, *delimiter.str)
-			} else if delimiter.regex != nil {
-				delims := delimiter.regex.FindAllStringIndex(str, -1)
-				if len(delims) > 0 && delims[len(delims)-1][1] == len(str) {
-					str = str[:delims[len(delims)-1][0]]
-				}
+		if fileFlag {
+			// The path is substituted even if the file could not be written
+			// so that the command does not take the wrong argument
+			path, _ := files.write(values)
+			return quote(path)
+		}
+		if quoted {
+			for idx, value := range values {
+				values[idx] = quote(value)
 			}
-			str = strings.TrimSpace(str)
-			replacements[idx] = quoteEntry(str)
 		}
-		return strings.Join(replacements, " ")
+		return strings.Join(values, " ")
 	})
 }
 
+// newTempFiles returns tempFiles for a command. The values in the files are
+// separated by NUL characters with --read0 as they can contain newlines.
+func (t *Terminal) newTempFiles() *tempFiles {
+	if t.readZero {
+		return &tempFiles{sep: "\x00"}
+	}
+	return &tempFiles{sep: "\n"}
+}
+
 func (t *Terminal) redraw() {
 	t.tui.Clear()
 	t.tui.Refresh()
@@ -1219,19 +2403,110 @@ func (t *Terminal) executeCommand(template string, forcePlus bool, background bo
 	if !valid {
 		return
 	}
-	command := replacePlaceholder(template, t.ansi, t.delimiter, forcePlus, string(t.input), list)
+	files := t.newTempFiles()
+	defer files.remove()
+	command := replacePlaceholder(template, t.ansi, t.delimiter, forcePlus, string(t.input), list, files)
 	cmd := util.ExecCommand(command)
+	cmd.Env = t.commandEnv()
 	if !background {
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		t.tui.Pause(true)
-		cmd.Run()
+		t.lastStatus = util.ExitStatus(cmd.Run())
 		t.tui.Resume(true)
 		t.redraw()
 		t.refresh()
 	} else {
-		cmd.Run()
+		var errOut bytes.Buffer
+		cmd.Stderr = &errOut
+		t.lastStatus = util.ExitStatus(cmd.Run())
+		if t.lastStatus != 0 {
+			t.setFailure(t.lastStatus, errOut.String())
+		}
+	}
+}
+
+// commandEnv returns the environment of the commands. $FZF_EXIT is the exit
+// status of the last command of execute actions.
+func (t *Terminal) commandEnv() []string {
+	return append(os.Environ(), "FZF_EXIT="+strconv.Itoa(t.lastStatus))
+}
+
+// setFailure shows the exit status and the first line of the error output of
+// the failed command on the info line for a while
+func (t *Terminal) setFailure(status int, errOutput string) {
+	t.failure = "[failed]"
+	if status > 0 {
+		t.failure = fmt.Sprintf("[exit %d]", status)
+	}
+	if line := strings.TrimSpace(strings.SplitN(strings.TrimSpace(errOutput), "\n", 2)[0]); len(line) > 0 {
+		t.failure += " " + line
+	}
+	t.failureAt = time.Now()
+	go func() {
+		time.Sleep(failureDuration)
+		t.reqBox.Set(reqInfo, nil)
+	}()
+}
+
+// historyEntries returns the NUL-separated entries of the queries for the
+// child process. Each entry starts with the index of the query followed by a
+// tab so that the query can be restored even if it contains NUL, which is
+// displayed as \0.
+func historyEntries(queries []string) string {
+	entries := make([]string, len(queries))
+	for idx, query := range queries {
+		entries[idx] = strconv.Itoa(idx) + "\t" + strings.Replace(query, "\x00", `\0`, -1)
+	}
+	return strings.Join(entries, "\x00")
+}
+
+// historySelection returns the query of the entry selected in the child process
+func historySelection(queries []string, entry string) (string, bool) {
+	tokens := strings.SplitN(strings.TrimSuffix(entry, "\x00"), "\t", 2)
+	idx, err := strconv.Atoi(tokens[0])
+	if err != nil || len(tokens) < 2 || idx < 0 || idx >= len(queries) {
+		return "", false
+	}
+	return queries[idx], true
+}
+
+// historySearch runs another fzf process on the queries in the history and
+// replaces the query with the selected one
+func (t *Terminal) historySearch() {
+	queries := t.history.queries()
+	if len(queries) == 0 {
+		return
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		executable = os.Args[0]
+	}
+	// NUL cannot be passed as an argument
+	query := strings.Replace(string(t.input), "\x00", "", -1)
+	cmd := exec.Command(executable, "--read0", "--print0", "--no-sort", "--no-multi",
+		"--no-history", "--delimiter", "\t", "--with-nth", "2..",
+		"--prompt", "History> ", "--query", query)
+	// Ignore the default options that can change the format of the output
+	cmd.Env = []string{}
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "FZF_DEFAULT_OPTS=") && !strings.HasPrefix(env, "FZF_DEFAULT_OPTS_FILE=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	cmd.Stdin = strings.NewReader(historyEntries(queries))
+	cmd.Stderr = os.Stderr
+	t.tui.Pause(true)
+	out, err := cmd.Output()
+	t.tui.Resume(true)
+	t.redraw()
+	t.refresh()
+	if err == nil {
+		if query, ok := historySelection(queries, string(out)); ok && len(query) > 0 {
+			t.input = trimQuery(query)
+			t.cx = len(t.input)
+		}
 	}
 }
 
@@ -1274,9 +2549,58 @@ func (t *Terminal) truncateQuery() {
 	t.cx = util.Constrain(t.cx, 0, len(t.input))
 }
 
-func (t *Terminal) selectItem(item *Item) {
+// selectItem selects the item. Returns false if the item cannot be selected
+// because of --max-selections.
+func (t *Terminal) selectItem(item *Item) bool {
+	if _, found := t.selected[item.Index()]; !found && t.selectionFull() {
+		return false
+	}
 	t.selected[item.Index()] = selectedItem{time.Now(), item}
 	t.version++
+	return true
+}
+
+func (t *Terminal) selectionFull() bool {
+	return t.maxSelect > 0 && len(t.selected) >= t.maxSelect
+}
+
+// selectRange selects the items in the list between the anchor, the item
+// toggled last, and the cursor
+func (t *Terminal) selectRange() {
+	if t.cy >= t.merger.Length() {
+		return
+	}
+	from := t.cy
+	if t.anchor >= 0 {
+		if idx := t.merger.FindIndex(t.anchor); idx >= 0 {
+			from = idx
+		}
+	}
+	step := 1
+	if from > t.cy {
+		step = -1
+	}
+	// Select from the anchor so that the items close to it are selected first
+	for i := from; ; i += step {
+		if !t.selectItem(t.merger.Get(i).item) || i == t.cy {
+			break
+		}
+	}
+}
+
+// selectMatching selects the items in the list that match the query
+func (t *Terminal) selectMatching(query string) {
+	if t.patternBuilder == nil {
+		return
+	}
+	pattern := t.patternBuilder([]rune(query))
+	slab := util.MakeSlab(slab16Size, slab32Size)
+	for i := 0; i < t.merger.Length(); i++ {
+		item := t.merger.Get(i).item
+		if result, _, _ := pattern.MatchItem(item, false, slab); result != nil && !t.selectItem(item) {
+			break
+		}
+	}
 }
 
 func (t *Terminal) deselectItem(item *Item) {
@@ -1367,26 +2691,31 @@ func (t *Terminal) Loop() {
 				})
 				// We don't display preview window if no match
 				if request[0] != nil {
+					files := t.newTempFiles()
 					command := replacePlaceholder(t.preview.command,
-						t.ansi, t.delimiter, false, string(t.input), request)
+						t.ansi, t.delimiter, false, string(t.input), request, files)
 					cmd := util.ExecCommand(command)
+					env := t.commandEnv()
 					if t.pwindow != nil {
-						env := os.Environ()
 						env = append(env, fmt.Sprintf("LINES=%d", t.pwindow.Height()))
 						env = append(env, fmt.Sprintf("COLUMNS=%d", t.pwindow.Width()))
-						cmd.Env = env
 					}
-					out, _ := cmd.CombinedOutput()
-					t.reqBox.Set(reqPreviewDisplay, string(out))
+					cmd.Env = env
+					var out, errOut bytes.Buffer
+					cmd.Stdout = &out
+					cmd.Stderr = &errOut
+					err := cmd.Run()
+					files.remove()
+					t.reqBox.Set(reqPreviewDisplay, previewResult{out.String(), errOut.String(), util.ExitStatus(err)})
 				} else {
-					t.reqBox.Set(reqPreviewDisplay, "")
+					t.reqBox.Set(reqPreviewDisplay, previewResult{})
 				}
 			}
 		}()
 	}
 
 	exit := func(getCode func() int) {
-		if !t.cleanExit && t.fullscreen && t.inlineInfo {
+		if !t.cleanExit && t.fullscreen && t.infoOnPromptLine() {
 			t.placeCursor()
 		}
 		t.tui.Close()
@@ -1394,6 +2723,11 @@ func (t *Terminal) Loop() {
 		if code <= exitNoMatch && t.history != nil {
 			t.history.append(string(t.input))
 		}
+		if t.session != nil {
+			if err := t.saveSession(); err != nil {
+				fmt.Fprintln(os.Stderr, "failed to save session: "+err.Error())
+			}
+		}
 		// prof.Stop()
 		os.Exit(code)
 	}
@@ -1409,7 +2743,7 @@ func (t *Terminal) Loop() {
 					switch req {
 					case reqPrompt:
 						t.printPrompt()
-						if t.inlineInfo {
+						if t.infoOnPromptLine() {
 							t.printInfo()
 						}
 					case reqInfo:
@@ -1447,8 +2781,19 @@ func (t *Terminal) Loop() {
 							return exitNoMatch
 						})
 					case reqPreviewDisplay:
-						t.previewer.text = value.(string)
+						result := value.(previewResult)
+						text := result.output
+						if len(text) > 0 && len(result.errOutput) > 0 && !strings.HasSuffix(text, "\n") {
+							text += "\n"
+						}
+						// The error output is displayed after the output
+						t.previewer.errLine = -1
+						if len(result.errOutput) > 0 {
+							t.previewer.errLine = strings.Count(text, "\n")
+						}
+						t.previewer.text = text + result.errOutput
 						t.previewer.lines = strings.Count(t.previewer.text, "\n")
+						t.previewer.status = result.status
 						t.previewer.offset = 0
 						t.printPreview()
 					case reqPreviewRefresh:
@@ -1470,11 +2815,36 @@ func (t *Terminal) Loop() {
 	}()
 
 	looping := true
+	replay := []tui.Event{}
+	skipSequence := false
 	for looping {
-		event := t.tui.GetChar()
+		var event tui.Event
+		if len(replay) > 0 {
+			event = replay[0]
+			replay = replay[1:]
+		} else if len(t.pending) > 0 {
+			var ok bool
+			if event, ok = t.tui.GetCharTimeout(keySequenceTimeout); !ok {
+				// Process the pending keys with the single-key bindings
+				t.mutex.Lock()
+				replay = t.pending
+				skipSequence = true
+				t.setPending([]tui.Event{})
+				t.mutex.Unlock()
+				t.reqBox.Set(reqInfo, nil)
+				continue
+			}
+		} else {
+			event = t.tui.GetChar()
+		}
 
 		t.mutex.Lock()
-		previousInput := t.input
+		if t.restore != nil {
+			// Do not move the cursor once the user started interacting
+			t.restore.focus = nil
+			t.restore.focused = nil
+		}
+		edit := t.beginEdit()
 		events := []util.EventType{reqPrompt}
 		req := func(evts ...util.EventType) {
 			for _, event := range evts {
@@ -1486,7 +2856,9 @@ func (t *Terminal) Loop() {
 		}
 		toggle := func() {
 			if t.cy < t.merger.Length() {
-				t.toggleItem(t.merger.Get(t.cy).item)
+				item := t.merger.Get(t.cy).item
+				t.toggleItem(item)
+				t.anchor = item.Index()
 				req(reqInfo)
 			}
 		}
@@ -1495,17 +2867,23 @@ func (t *Terminal) Loop() {
 				t.previewer.offset+amount, 0, t.previewer.lines-1)
 			req(reqPreviewRefresh)
 		}
-		for key, ret := range t.expect {
-			if keyMatch(key, event) {
-				t.pressed = ret
-				t.reqBox.Set(reqClose, nil)
-				t.mutex.Unlock()
-				return
-			}
+		expectKey := event.Key()
+		if event.Type == tui.Mouse && event.MouseEvent.Double {
+			expectKey = tui.KeyOf(tui.DoubleClick)
+		}
+		pressed, prs := t.expect[expectKey]
+		if legacy, ok := tui.LegacyKey(expectKey); !prs && ok {
+			pressed, prs = t.expect[legacy]
+		}
+		if prs {
+			t.pressed = pressed
+			t.reqBox.Set(reqClose, nil)
+			t.mutex.Unlock()
+			return
 		}
 
-		var doAction func(action, int) bool
-		doActions := func(actions []action, mapkey int) bool {
+		var doAction func(action, tui.Key) bool
+		doActions := func(actions []action, mapkey tui.Key) bool {
 			for _, action := range actions {
 				if !doAction(action, mapkey) {
 					return false
@@ -1513,11 +2891,14 @@ func (t *Terminal) Loop() {
 			}
 			return true
 		}
-		doAction = func(a action, mapkey int) bool {
+		doAction = func(a action, mapkey tui.Key) bool {
 			switch a.t {
 			case actIgnore:
 			case actExecute, actExecuteSilent:
 				t.executeCommand(a.a, false, a.t == actExecuteSilent)
+				if a.t == actExecuteSilent {
+					req(reqInfo)
+				}
 			case actExecuteMulti:
 				t.executeCommand(a.a, true, false)
 			case actInvalid:
@@ -1536,12 +2917,23 @@ func (t *Terminal) Loop() {
 					}
 					req(reqList, reqInfo, reqHeader)
 				}
+			case actToggleTrack:
+				t.track = !t.track
+				req(reqInfo)
 			case actTogglePreviewWrap:
 				if t.hasPreviewWindow() {
 					t.preview.wrap = !t.preview.wrap
 					req(reqPreviewRefresh)
 				}
 			case actToggleSort:
+				if t.listMerger != nil {
+					// Switch the order of the selected view
+					t.viewByIndex = !t.viewByIndex
+					t.viewVersion = -1
+					t.updateSelectedView()
+					req(reqList, reqInfo)
+					break
+				}
 				t.sort = !t.sort
 				t.eventBox.Set(EvtSearchNew, t.sort)
 				t.mutex.Unlock()
@@ -1589,7 +2981,7 @@ func (t *Terminal) Loop() {
 				if len(t.input) == 0 {
 					req(reqQuit)
 				} else {
-					t.yanked = t.input
+					t.kill(t.input)
 					t.input = []rune{}
 					t.cx = 0
 				}
@@ -1627,13 +3019,37 @@ func (t *Terminal) Loop() {
 					}
 					req(reqList, reqInfo)
 				}
+			case actSelectRange:
+				if t.multi {
+					t.selectRange()
+					req(reqList, reqInfo)
+				}
+			case actSelectMatching:
+				if t.multi {
+					t.selectMatching(a.a)
+					req(reqList, reqInfo)
+				}
+			case actToggleSelectedView:
+				if t.multi {
+					t.toggleSelectedView()
+					req(reqList, reqInfo)
+				}
+			case actMoveSelectedUp, actMoveSelectedDown:
+				if t.multi {
+					if a.t == actMoveSelectedUp {
+						t.moveSelected(1)
+					} else {
+						t.moveSelected(-1)
+					}
+					req(reqList)
+				}
 			case actToggleIn:
-				if t.reverse {
+				if t.layout != layoutDefault {
 					return doAction(action{t: actToggleUp}, mapkey)
 				}
 				return doAction(action{t: actToggleDown}, mapkey)
 			case actToggleOut:
-				if t.reverse {
+				if t.layout != layoutDefault {
 					return doAction(action{t: actToggleDown}, mapkey)
 				}
 				return doAction(action{t: actToggleUp}, mapkey)
@@ -1668,7 +3084,7 @@ func (t *Terminal) Loop() {
 				req(reqList)
 			case actUnixLineDiscard:
 				if t.cx > 0 {
-					t.yanked = copySlice(t.input[:t.cx])
+					t.kill(t.input[:t.cx])
 					t.input = t.input[t.cx:]
 					t.cx = 0
 				}
@@ -1680,10 +3096,8 @@ func (t *Terminal) Loop() {
 				if t.cx > 0 {
 					t.rubout(t.wordRubout)
 				}
-			case actYank:
-				suffix := copySlice(t.input[t.cx:])
-				t.input = append(append(t.input[:t.cx], t.yanked...), suffix...)
-				t.cx += len(t.yanked)
+			case actRune, actYank, actYankPop, actUndo, actRedo:
+				t.editQuery(a, event, edit)
 			case actPageUp:
 				t.vmove(t.maxItems()-1, false)
 				req(reqList)
@@ -1710,18 +3124,19 @@ func (t *Terminal) Loop() {
 				ncx := t.cx +
 					findFirstMatch(t.wordNext, string(t.input[t.cx:])) + 1
 				if ncx > t.cx {
-					t.yanked = copySlice(t.input[t.cx:ncx])
+					t.kill(t.input[t.cx:ncx])
 					t.input = append(t.input[:t.cx], t.input[ncx:]...)
 				}
 			case actKillLine:
 				if t.cx < len(t.input) {
-					t.yanked = copySlice(t.input[t.cx:])
+					t.kill(t.input[t.cx:])
 					t.input = t.input[:t.cx]
 				}
-			case actRune:
+			case actPaste:
+				text := pastedQuery(event.Text)
 				prefix := copySlice(t.input[:t.cx])
-				t.input = append(append(prefix, event.Char), t.input[t.cx:]...)
-				t.cx++
+				t.input = append(append(prefix, text...), t.input[t.cx:]...)
+				t.cx += len(text)
 			case actPreviousHistory:
 				if t.history != nil {
 					t.history.override(string(t.input))
@@ -1734,6 +3149,10 @@ func (t *Terminal) Loop() {
 					t.input = trimQuery(t.history.next())
 					t.cx = len(t.input)
 				}
+			case actHistorySearch:
+				if t.history != nil {
+					t.historySearch()
+				}
 			case actSigStop:
 				p, err := os.FindProcess(os.Getpid())
 				if err == nil {
@@ -1746,7 +3165,32 @@ func (t *Terminal) Loop() {
 			case actMouse:
 				me := event.MouseEvent
 				mx, my := me.X, me.Y
-				if me.S != 0 {
+				if t.dragging != barNone {
+					if me.Down {
+						t.scrollTo(t.dragging, my)
+						if t.dragging == barList {
+							req(reqList)
+						} else {
+							req(reqPreviewRefresh)
+						}
+					} else {
+						t.dragging = barNone
+					}
+				} else if me.Down && !me.Double && t.scrollbarAt(my, mx) != barNone {
+					t.dragging = t.scrollbarAt(my, mx)
+					return doAction(a, mapkey)
+				} else if me.Drag {
+					// Select the items from the anchor while dragging with
+					// a modifier key. Other dragging outside of the
+					// scrollbars is ignored.
+					if t.multi && me.Mod && t.window.Enclose(my, mx) {
+						my = t.screenToLine(my - t.window.Top())
+						if min := t.listOffset(); my >= min && t.vset(t.offset+my-min) {
+							t.selectRange()
+							req(reqList, reqInfo)
+						}
+					}
+				} else if me.S != 0 {
 					// Scroll
 					if t.window.Enclose(my, mx) && t.merger.Length() > 0 {
 						if t.multi && me.Mod {
@@ -1761,18 +3205,13 @@ func (t *Terminal) Loop() {
 					mx -= t.window.Left()
 					my -= t.window.Top()
 					mx = util.Constrain(mx-t.promptLen, 0, len(t.input))
-					if !t.reverse {
-						my = t.window.Height() - my - 1
-					}
-					min := 2 + len(t.header)
-					if t.inlineInfo {
-						min--
-					}
+					min := t.listOffset()
+					my = t.screenToLine(my)
 					if me.Double {
 						// Double-click
 						if my >= min {
 							if t.vset(t.offset+my-min) && t.cy < t.merger.Length() {
-								return doActions(t.keymap[tui.DoubleClick], tui.DoubleClick)
+								return doActions(t.keymap[tui.KeyOf(tui.DoubleClick)], tui.KeyOf(tui.DoubleClick))
 							}
 						}
 					} else if me.Down {
@@ -1786,37 +3225,71 @@ func (t *Terminal) Loop() {
 							}
 							req(reqList)
 							if me.Left {
-								return doActions(t.keymap[tui.LeftClick], tui.LeftClick)
+								return doActions(t.keymap[tui.KeyOf(tui.LeftClick)], tui.KeyOf(tui.LeftClick))
 							}
-							return doActions(t.keymap[tui.RightClick], tui.RightClick)
+							return doActions(t.keymap[tui.KeyOf(tui.RightClick)], tui.KeyOf(tui.RightClick))
 						}
 					}
 				}
 			}
 			return true
 		}
+		var sequenceActions []action
+		if t.jumping == jumpDisabled && !skipSequence && len(t.sequences) > 0 {
+			var consumed bool
+			var events []tui.Event
+			sequenceActions, consumed, events = t.feedSequence(event)
+			if len(events) > 0 {
+				// Process the first key with the single-key bindings and
+				// start over from the next one
+				replay = append(events, replay...)
+				skipSequence = true
+				t.mutex.Unlock()
+				continue
+			}
+			if consumed && sequenceActions == nil {
+				t.mutex.Unlock()
+				t.reqBox.Set(reqInfo, nil)
+				continue
+			}
+			if consumed {
+				req(reqInfo)
+			}
+		}
+		skipSequence = false
+
 		changed := false
-		mapkey := event.Type
+		mapkey := event.Key()
 		if t.jumping == jumpDisabled {
-			actions := t.keymap[mapkey]
-			if mapkey == tui.Rune {
-				mapkey = int(event.Char) + int(tui.AltZ)
-				if act, prs := t.keymap[mapkey]; prs {
-					actions = act
+			actions := sequenceActions
+			if actions == nil {
+				actions = t.keyActions(event)
+				if t.vi != nil && t.vi.mode != edit.mode {
+					req(reqInfo)
 				}
 			}
 			if !doActions(actions, mapkey) {
 				continue
 			}
 			t.truncateQuery()
-			changed = string(previousInput) != string(t.input)
-			if onChanges, prs := t.keymap[tui.Change]; changed && prs {
-				if !doActions(onChanges, tui.Change) {
+			changed = t.endEdit(edit)
+			if changed {
+				// New items are counted again on the result of the new query
+				t.followMark = -1
+			}
+			if changed && t.listMerger != nil {
+				// Show the result of the new query
+				t.toggleSelectedView()
+				req(reqList)
+			}
+			t.updateSelectedView()
+			if onChanges, prs := t.keymap[tui.KeyOf(tui.Change)]; changed && prs {
+				if !doActions(onChanges, tui.KeyOf(tui.Change)) {
 					continue
 				}
 			}
 		} else {
-			if mapkey == tui.Rune {
+			if event.Type == tui.Rune {
 				if idx := strings.IndexRune(t.jumpLabels, event.Char); idx >= 0 && idx < t.maxItems() && idx < t.merger.Length() {
 					t.cy = idx + t.offset
 					if t.jumping == jumpAcceptEnabled {
@@ -1827,6 +3300,12 @@ func (t *Terminal) Loop() {
 			t.jumping = jumpDisabled
 			req(reqList)
 		}
+		if t.newItems > 0 && (t.followMark < 0 || t.atNewestEnd()) {
+			// The new items are seen
+			t.followMark = -1
+			t.newItems = 0
+			req(reqInfo)
+		}
 		t.mutex.Unlock() // Must be unlocked before touching reqBox
 
 		if changed {
@@ -1838,6 +3317,65 @@ func (t *Terminal) Loop() {
 	}
 }
 
+// feedSequence feeds the key event to the key sequences. Returns the actions
+// of the sequence when it is completed, or true if the event is consumed as a
+// part of an incomplete sequence. If the event does not continue the pending
+// sequence, the pending events and the event are returned to be processed
+// individually.
+func (t *Terminal) feedSequence(event tui.Event) ([]action, bool, []tui.Event) {
+	switch event.Type {
+	case tui.Invalid, tui.Resize, tui.Mouse:
+		return nil, false, nil
+	}
+	keys := make([]tui.Key, len(t.pending)+1)
+	for idx, pending := range t.pending {
+		keys[idx] = pending.Key()
+	}
+	keys[len(t.pending)] = event.Key()
+
+	prefix := false
+	for _, sequence := range t.sequences {
+		if sequence.matches(keys) {
+			t.setPending([]tui.Event{})
+			return sequence.actions, true, nil
+		}
+		prefix = prefix || sequence.hasPrefix(keys)
+	}
+	if prefix {
+		t.setPending(append(t.pending, event))
+		return nil, true, nil
+	}
+	if len(t.pending) == 0 {
+		return nil, false, nil
+	}
+	replay := append(t.pending, event)
+	t.setPending([]tui.Event{})
+	return nil, false, replay
+}
+
+// setPending updates the pending events of the key sequence. The Loop
+// processes them individually if no key is pressed within the timeout.
+func (t *Terminal) setPending(events []tui.Event) {
+	t.pending = events
+}
+
+// pendingNames returns the names of the pending keys of the key sequence
+func (t *Terminal) pendingNames() []string {
+	if len(t.pending) == 0 {
+		return nil
+	}
+	keys := make([]tui.Key, len(t.pending))
+	for idx, pending := range t.pending {
+		keys[idx] = pending.Key()
+	}
+	for _, sequence := range t.sequences {
+		if sequence.hasPrefix(keys) {
+			return sequence.names[:len(keys)]
+		}
+	}
+	return nil
+}
+
 func (t *Terminal) constrain() {
 	count := t.merger.Length()
 	height := t.maxItems()
@@ -1854,7 +3392,7 @@ func (t *Terminal) constrain() {
 }
 
 func (t *Terminal) vmove(o int, allowCycle bool) {
-	if t.reverse {
+	if t.layout != layoutDefault {
 		o *= -1
 	}
 	dest := t.cy + o
@@ -1879,9 +3417,6 @@ func (t *Terminal) vset(o int) bool {
 }
 
 func (t *Terminal) maxItems() int {
-	max := t.window.Height() - 2 - len(t.header)
-	if t.inlineInfo {
-		max++
-	}
+	max := t.window.Height() - t.listOffset()
 	return util.Max(max, 0)
 }
@@ -1,9 +1,16 @@
 package fzf
 
 import (
+	"io/ioutil"
+	"os"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/junegunn/fzf/src/algo"
+	"github.com/junegunn/fzf/src/tui"
 	"github.com/junegunn/fzf/src/util"
 )
 
@@ -29,69 +36,144 @@ func TestReplacePlaceholder(t *testing.T) {
 	}
 
 	// {}, preserve ansi
-	result = replacePlaceholder("echo {}", false, Delimiter{}, false, "query", items1)
+	result = replacePlaceholder("echo {}", false, Delimiter{}, false, "query", items1, nil)
 	check("echo '  foo'\\''bar \x1b[31mbaz\x1b[m'")
 
 	// {}, strip ansi
-	result = replacePlaceholder("echo {}", true, Delimiter{}, false, "query", items1)
+	result = replacePlaceholder("echo {}", true, Delimiter{}, false, "query", items1, nil)
 	check("echo '  foo'\\''bar baz'")
 
 	// {}, with multiple items
-	result = replacePlaceholder("echo {}", true, Delimiter{}, false, "query", items2)
+	result = replacePlaceholder("echo {}", true, Delimiter{}, false, "query", items2, nil)
 	check("echo 'foo'\\''bar baz'")
 
 	// {..}, strip leading whitespaces, preserve ansi
-	result = replacePlaceholder("echo {..}", false, Delimiter{}, false, "query", items1)
+	result = replacePlaceholder("echo {..}", false, Delimiter{}, false, "query", items1, nil)
 	check("echo 'foo'\\''bar \x1b[31mbaz\x1b[m'")
 
 	// {..}, strip leading whitespaces, strip ansi
-	result = replacePlaceholder("echo {..}", true, Delimiter{}, false, "query", items1)
+	result = replacePlaceholder("echo {..}", true, Delimiter{}, false, "query", items1, nil)
 	check("echo 'foo'\\''bar baz'")
 
 	// {q}
-	result = replacePlaceholder("echo {} {q}", true, Delimiter{}, false, "query", items1)
+	result = replacePlaceholder("echo {} {q}", true, Delimiter{}, false, "query", items1, nil)
 	check("echo '  foo'\\''bar baz' 'query'")
 
 	// {q}, multiple items
-	result = replacePlaceholder("echo {+}{q}{+}", true, Delimiter{}, false, "query 'string'", items2)
+	result = replacePlaceholder("echo {+}{q}{+}", true, Delimiter{}, false, "query 'string'", items2, nil)
 	check("echo 'foo'\\''bar baz' 'FOO'\\''BAR BAZ''query '\\''string'\\''''foo'\\''bar baz' 'FOO'\\''BAR BAZ'")
 
-	result = replacePlaceholder("echo {}{q}{}", true, Delimiter{}, false, "query 'string'", items2)
+	result = replacePlaceholder("echo {}{q}{}", true, Delimiter{}, false, "query 'string'", items2, nil)
 	check("echo 'foo'\\''bar baz''query '\\''string'\\''''foo'\\''bar baz'")
 
-	result = replacePlaceholder("echo {1}/{2}/{2,1}/{-1}/{-2}/{}/{..}/{n.t}/\\{}/\\{1}/\\{q}/{3}", true, Delimiter{}, false, "query", items1)
+	result = replacePlaceholder("echo {1}/{2}/{2,1}/{-1}/{-2}/{}/{..}/{n.t}/\\{}/\\{1}/\\{q}/{3}", true, Delimiter{}, false, "query", items1, nil)
 	check("echo 'foo'\\''bar'/'baz'/'bazfoo'\\''bar'/'baz'/'foo'\\''bar'/'  foo'\\''bar baz'/'foo'\\''bar baz'/{n.t}/{}/{1}/{q}/''")
 
-	result = replacePlaceholder("echo {1}/{2}/{-1}/{-2}/{..}/{n.t}/\\{}/\\{1}/\\{q}/{3}", true, Delimiter{}, false, "query", items2)
+	result = replacePlaceholder("echo {1}/{2}/{-1}/{-2}/{..}/{n.t}/\\{}/\\{1}/\\{q}/{3}", true, Delimiter{}, false, "query", items2, nil)
 	check("echo 'foo'\\''bar'/'baz'/'baz'/'foo'\\''bar'/'foo'\\''bar baz'/{n.t}/{}/{1}/{q}/''")
 
-	result = replacePlaceholder("echo {+1}/{+2}/{+-1}/{+-2}/{+..}/{n.t}/\\{}/\\{1}/\\{q}/{+3}", true, Delimiter{}, false, "query", items2)
+	result = replacePlaceholder("echo {+1}/{+2}/{+-1}/{+-2}/{+..}/{n.t}/\\{}/\\{1}/\\{q}/{+3}", true, Delimiter{}, false, "query", items2, nil)
 	check("echo 'foo'\\''bar' 'FOO'\\''BAR'/'baz' 'BAZ'/'baz' 'BAZ'/'foo'\\''bar' 'FOO'\\''BAR'/'foo'\\''bar baz' 'FOO'\\''BAR BAZ'/{n.t}/{}/{1}/{q}/'' ''")
 
 	// forcePlus
-	result = replacePlaceholder("echo {1}/{2}/{-1}/{-2}/{..}/{n.t}/\\{}/\\{1}/\\{q}/{3}", true, Delimiter{}, true, "query", items2)
+	result = replacePlaceholder("echo {1}/{2}/{-1}/{-2}/{..}/{n.t}/\\{}/\\{1}/\\{q}/{3}", true, Delimiter{}, true, "query", items2, nil)
 	check("echo 'foo'\\''bar' 'FOO'\\''BAR'/'baz' 'BAZ'/'baz' 'BAZ'/'foo'\\''bar' 'FOO'\\''BAR'/'foo'\\''bar baz' 'FOO'\\''BAR BAZ'/{n.t}/{}/{1}/{q}/'' ''")
 
 	// No match
-	result = replacePlaceholder("echo {}/{+}", true, Delimiter{}, false, "query", []*Item{nil, nil})
+	result = replacePlaceholder("echo {}/{+}", true, Delimiter{}, false, "query", []*Item{nil, nil}, nil)
 	check("echo /")
 
 	// No match, but with selections
-	result = replacePlaceholder("echo {}/{+}", true, Delimiter{}, false, "query", []*Item{nil, item1})
+	result = replacePlaceholder("echo {}/{+}", true, Delimiter{}, false, "query", []*Item{nil, item1}, nil)
 	check("echo /'  foo'\\''bar baz'")
 
+	// {n} and {+n}, the indexes of the items
+	for idx, item := range items2 {
+		item.text.Index = int32(idx + 10)
+	}
+	result = replacePlaceholder("echo {n}/{+n}/\\{n}/{n.t}", true, Delimiter{}, false, "query", items2, nil)
+	check("echo 10/11 12/{n}/{n.t}")
+	result = replacePlaceholder("echo {n}", true, Delimiter{}, false, "query", []*Item{nil, nil}, nil)
+	check("echo ")
+
 	// String delimiter
 	delim := "'"
-	result = replacePlaceholder("echo {}/{1}/{2}", true, Delimiter{str: &delim}, false, "query", items1)
+	result = replacePlaceholder("echo {}/{1}/{2}", true, Delimiter{str: &delim}, false, "query", items1, nil)
 	check("echo '  foo'\\''bar baz'/'foo'/'bar baz'")
 
 	// Regex delimiter
 	regex := regexp.MustCompile("[oa]+")
 	// foo'bar baz
-	result = replacePlaceholder("echo {}/{1}/{3}/{2..3}", true, Delimiter{regex: regex}, false, "query", items1)
+	result = replacePlaceholder("echo {}/{1}/{3}/{2..3}", true, Delimiter{regex: regex}, false, "query", items1, nil)
 	check("echo '  foo'\\''bar baz'/'f'/'r b'/''\\''bar b'")
 }
 
+func TestReplacePlaceholderFile(t *testing.T) {
+	items := []*Item{newItem("foo bar"), newItem("foo bar"), newItem("baz\nqux")}
+	items[2].text.Index = 3
+	files := &tempFiles{sep: "\x00"}
+	result := replacePlaceholder("cat {+f}/{f2}/{+fn}/{+n}", true, Delimiter{}, false, "query", items, files)
+	if len(files.paths) != 3 {
+		t.Fatalf("three files should be created: %v", files.paths)
+	}
+	expected := []string{"foo bar\x00baz\nqux\x00", "bar\x00", "0\x003\x00"}
+	for idx, path := range files.paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil || string(data) != expected[idx] {
+			t.Errorf("invalid file: %q, %v", data, err)
+		}
+	}
+	quoted := []string{}
+	for _, path := range files.paths {
+		quoted = append(quoted, quoteEntry(path))
+	}
+	if result != "cat "+strings.Join(quoted, "/")+"/0 3" {
+		t.Errorf("invalid command: %s", result)
+	}
+	paths := files.paths
+	files.remove()
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("file not removed: %s", path)
+		}
+	}
+
+	// Left as they are without files
+	result = replacePlaceholder("cat {+f}", true, Delimiter{}, false, "query", items, nil)
+	if result != "cat {+f}" {
+		t.Errorf("invalid command: %s", result)
+	}
+}
+
+func TestFormatOutput(t *testing.T) {
+	item := newItem("foo'bar \x1b[31mbaz\x1b[m")
+	check := func(template string, expected string) {
+		if result := formatOutput(template, true, Delimiter{}, "q'uery", "ctrl-y", 2, item); result != expected {
+			t.Errorf("expected: %s, actual: %s", expected, result)
+		}
+	}
+	// Values are not quoted
+	check("{}", "foo'bar baz")
+	check("{2}:{1}", "baz:foo'bar")
+	check("{+}", "foo'bar baz")
+	check(`{"i":{i},"k":"{k}","q":"{q}"}`, `{"i":2,"k":"ctrl-y","q":"q'uery"}`)
+	check("\\{k}/{x}", "{k}/{x}")
+	item.text.Index = 7
+	check("{n}:{+n}", "7:7")
+
+	term := &Terminal{
+		selected:  make(map[int32]selectedItem),
+		merger:    NewMerger(nil, [][]Result{[]Result{Result{item: item}}}, false, false),
+		input:     []rune("query"),
+		pressed:   "ctrl-y",
+		outputFmt: "{i} {k} {q} {-1}"}
+	output := []string{}
+	term.printer = func(str string) { output = append(output, str) }
+	if !term.output() || strings.Join(output, "|") != "0 ctrl-y query \x1b[31mbaz\x1b[m" {
+		t.Errorf("invalid output: %q", output)
+	}
+}
+
 func TestQuoteEntryCmd(t *testing.T) {
 	tests := map[string]string{
 		`"`:                       `^"\^"^"`,
@@ -110,3 +192,464 @@ func TestQuoteEntryCmd(t *testing.T) {
 		}
 	}
 }
+
+func TestHistorySearchEntries(t *testing.T) {
+	queries := []string{"foo", "bar\x00baz", "", "a\tb"}
+	entries := historyEntries(queries)
+	if entries != "0\tfoo\x001\tbar\\0baz\x002\t\x003\ta\tb" {
+		t.Errorf("%q", entries)
+	}
+	for idx, entry := range strings.Split(entries, "\x00") {
+		if query, ok := historySelection(queries, entry+"\x00"); !ok || query != queries[idx] {
+			t.Errorf("%q: %q", entry, query)
+		}
+	}
+	for _, entry := range []string{"", "foo", "4\tfoo", "-1\tfoo", "1"} {
+		if _, ok := historySelection(queries, entry); ok {
+			t.Errorf("%q should be invalid", entry)
+		}
+	}
+}
+
+func TestCalculateScrollbar(t *testing.T) {
+	check := func(total int, size int, offset int, expectedLength int, expectedStart int) {
+		length, start := calculateScrollbar(total, size, offset)
+		if length != expectedLength || start != expectedStart {
+			t.Errorf("%d/%d/%d: expected (%d, %d), actual (%d, %d)",
+				total, size, offset, expectedLength, expectedStart, length, start)
+		}
+	}
+	// Everything fits in the window
+	check(10, 10, 0, 0, 0)
+	check(5, 10, 0, 0, 0)
+	check(10, 0, 0, 0, 0)
+
+	check(20, 10, 0, 5, 0)
+	check(20, 10, 5, 5, 2)
+	check(20, 10, 10, 5, 5)
+
+	// Minimum length
+	check(1000, 10, 0, 1, 0)
+	check(1000, 10, 990, 1, 9)
+
+	// Offset out of range
+	check(20, 10, 15, 5, 5)
+}
+
+func TestTabulate(t *testing.T) {
+	term := &Terminal{tabstop: 8, columns: []tabularColumn{{5, 1}, {3, 1}}}
+	check := func(input string, expected string, positions []int32) {
+		output, pos := term.tabulate([]rune(input))
+		if string(output) != expected {
+			t.Errorf("Input: %q, expected: %q, actual: %q", input, expected, string(output))
+		}
+		for idx, p := range positions {
+			if pos[idx] != p {
+				t.Errorf("Input: %q, position of %d: expected %d, actual %d", input, idx, p, pos[idx])
+			}
+		}
+	}
+	check("foo bar baz", "foo   bar baz", []int32{0, 1, 2, 3, 6, 7, 8, 9, 10, 11, 12, 13})
+	check("  a b c d", "a     b   c d", []int32{0, 0, 0, 1, 6, 7, 10, 11, 12, 13})
+	check("foobarbaz x y", "foo.. x   y", []int32{0, 1, 2, 3, 3, 3, 3, 3, 3, 5, 6, 7, 10, 11})
+	check("single", "single", []int32{0, 1, 2, 3, 4, 5, 6})
+}
+
+func TestFeedSequence(t *testing.T) {
+	g := tui.Event{Type: tui.Rune, Char: 'g'}
+	x := tui.Event{Type: tui.Rune, Char: 'x'}
+	ctrlX := tui.Event{Type: tui.CtrlX}
+	term := &Terminal{
+		reqBox:  util.NewEventBox(),
+		pending: []tui.Event{},
+		sequences: []keySequence{
+			{[]tui.Key{g.Key(), g.Key()}, []string{"g", "g"}, toActions(actPageUp)},
+			{[]tui.Key{ctrlX.Key(), x.Key(), g.Key()}, []string{"ctrl-x", "x", "g"}, toActions(actPageDown)}}}
+
+	// Not a part of a sequence
+	if actions, consumed, replay := term.feedSequence(x); actions != nil || consumed || replay != nil {
+		t.Error("x should not be consumed")
+	}
+
+	// Completed sequence
+	if _, consumed, _ := term.feedSequence(g); !consumed || len(term.pending) != 1 {
+		t.Error("g should be pending")
+	}
+	if names := term.pendingNames(); len(names) != 1 || names[0] != "g" {
+		t.Errorf("invalid pending names: %v", names)
+	}
+	if actions, _, _ := term.feedSequence(g); len(actions) != 1 || actions[0].t != actPageUp || len(term.pending) != 0 {
+		t.Error("g g should be completed")
+	}
+
+	// Unmatched sequence falls through
+	term.feedSequence(ctrlX)
+	term.feedSequence(x)
+	actions, consumed, replay := term.feedSequence(x)
+	if actions != nil || consumed || len(replay) != 3 || replay[2] != x || len(term.pending) != 0 {
+		t.Errorf("ctrl-x x x should be replayed: %v", replay)
+	}
+}
+
+func TestUpdateListFollow(t *testing.T) {
+	chunk := Chunk{}
+	chunks := []*Chunk{&chunk}
+	term := &Terminal{
+		follow:     true,
+		followMark: -1,
+		merger:     EmptyMerger,
+		reqBox:     util.NewEventBox()}
+	push := func(count int) {
+		for ; chunk.count < count; chunk.count++ {
+			chunk.items[chunk.count].text.Index = int32(chunk.count)
+		}
+		term.UpdateList(PassMerger(&chunks, false))
+	}
+
+	// The cursor stays on the newest item
+	push(3)
+	push(5)
+	if term.cy != 4 || term.newItems != 0 {
+		t.Errorf("cursor should follow the newest item: %d, %d", term.cy, term.newItems)
+	}
+
+	// Items newer than the list are counted when the cursor is elsewhere
+	term.cy = 1
+	push(7)
+	push(8)
+	if term.cy != 1 || term.followMark != 5 || term.newItems != 3 {
+		t.Errorf("new items should be counted: %d, %d, %d", term.cy, term.followMark, term.newItems)
+	}
+}
+
+func TestKillRing(t *testing.T) {
+	term := &Terminal{killRing: [][]rune{}}
+	term.kill([]rune{})
+	if len(term.killRing) != 0 || len(term.lastKill()) != 0 {
+		t.Error("empty text should not be killed")
+	}
+	for i := 0; i < maxKillRing+2; i++ {
+		term.kill([]rune(strconv.Itoa(i)))
+	}
+	if len(term.killRing) != maxKillRing || string(term.killRing[0]) != "2" {
+		t.Errorf("invalid kill ring: %d", len(term.killRing))
+	}
+
+	term.killRing = [][]rune{[]rune("foo"), []rune("barbaz")}
+	term.input = []rune("[]")
+	term.cx = 1
+	term.yank(1, false)
+	if string(term.input) != "[barbaz]" || term.cx != 7 {
+		t.Errorf("%s %d", string(term.input), term.cx)
+	}
+	term.yank(0, true)
+	if string(term.input) != "[foo]" || term.cx != 4 {
+		t.Errorf("%s %d", string(term.input), term.cx)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	term := &Terminal{input: []rune("foo"), cx: 3, undoStack: []editState{}, redoStack: []editState{}}
+	term.recordEdit(editState{[]rune("fo"), 2})
+	term.recordEdit(editState{[]rune("f"), 1})
+	term.undo()
+	term.undo()
+	if string(term.input) != "fo" || term.cx != 2 {
+		t.Errorf("%s %d", string(term.input), term.cx)
+	}
+	term.undo()
+	if string(term.input) != "fo" {
+		t.Error("undo stack should be empty")
+	}
+	term.redo()
+	if string(term.input) != "f" || term.cx != 1 {
+		t.Errorf("%s %d", string(term.input), term.cx)
+	}
+	term.recordEdit(editState{[]rune("x"), 1})
+	if len(term.redoStack) != 0 {
+		t.Error("redo stack should be cleared")
+	}
+
+	// The oldest states are dropped
+	for i := 0; i < maxUndo+2; i++ {
+		term.recordEdit(editState{[]rune(strconv.Itoa(i)), 1})
+	}
+	if len(term.undoStack) != maxUndo || string(term.undoStack[0].input) != "2" {
+		t.Errorf("invalid undo stack: %d", len(term.undoStack))
+	}
+}
+
+func TestPastedQuery(t *testing.T) {
+	if query := string(pastedQuery("foo\r\nbar\tbaz\x1b\n")); query != "foo bar baz " {
+		t.Errorf("invalid query: %q", query)
+	}
+}
+
+func TestPadGutter(t *testing.T) {
+	term := &Terminal{tabstop: 8, pointerLen: 2, markerLen: 1}
+	if term.gutterWidth() != 3 {
+		t.Errorf("invalid gutter width: %d", term.gutterWidth())
+	}
+	for _, test := range []struct{ text, expected string }{
+		{"", "  "}, {"a", "a "}, {"가", "가"}, {"abc", "abc"}} {
+		if padded := term.padGutter(test.text, 2); padded != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.text, test.expected, padded)
+		}
+	}
+}
+
+func TestSelectRangeAndMatching(t *testing.T) {
+	var index int32
+	chunkList := NewChunkList(func(item *Item, data []byte) bool {
+		item.text = util.ToChars(data)
+		item.text.Index = index
+		index++
+		return true
+	})
+	for _, line := range []string{"foo", "bar", "baz", "foobar", "qux", "foobaz"} {
+		chunkList.Push([]byte(line))
+	}
+	chunks, _ := chunkList.Snapshot()
+	term := &Terminal{
+		multi:    true,
+		selected: make(map[int32]selectedItem),
+		merger:   PassMerger(&chunks, false),
+		anchor:   -1,
+		patternBuilder: func(runes []rune) *Pattern {
+			return BuildPattern(true, algo.FuzzyMatchV2, true, CaseSmart, false, true,
+				false, []Range{}, Delimiter{}, runes)
+		}}
+	selected := func() string {
+		indexes := []string{}
+		for i := 0; i < term.merger.Length(); i++ {
+			if _, found := term.selected[int32(i)]; found {
+				indexes = append(indexes, strconv.Itoa(i))
+			}
+		}
+		return strings.Join(indexes, ",")
+	}
+
+	// Without the anchor, only the current item is selected
+	term.cy = 1
+	term.selectRange()
+	if selected() != "1" {
+		t.Errorf("invalid selection: %s", selected())
+	}
+	term.anchor = 4
+	term.selectRange()
+	if selected() != "1,2,3,4" {
+		t.Errorf("invalid selection: %s", selected())
+	}
+
+	term.selected = make(map[int32]selectedItem)
+	term.selectMatching("^foo !baz")
+	if selected() != "0,3" {
+		t.Errorf("invalid selection: %s", selected())
+	}
+
+	// Items closer to the anchor are selected first
+	term.selected = make(map[int32]selectedItem)
+	term.maxSelect = 2
+	term.cy = 0
+	term.selectRange()
+	if selected() != "3,4" {
+		t.Errorf("invalid selection: %s", selected())
+	}
+	term.selectMatching("foo")
+	if selected() != "3,4" || term.selectItem(term.merger.Get(0).item) {
+		t.Errorf("selection should be limited: %s", selected())
+	}
+	if !term.selectItem(term.merger.Get(3).item) {
+		t.Error("selected item should be selectable")
+	}
+}
+
+func TestSelectMatchingWhileSearching(t *testing.T) {
+	defer clearPatternCache()
+	var index int32
+	chunkList := NewChunkList(func(item *Item, data []byte) bool {
+		item.text = util.ToChars(data)
+		item.text.Index = index
+		index++
+		return true
+	})
+	for _, line := range []string{"foo", "bar", "baz"} {
+		chunkList.Push([]byte(line))
+	}
+	chunks, _ := chunkList.Snapshot()
+	matcher := NewMatcher(func(runes []rune) *Pattern {
+		return BuildPattern(true, algo.FuzzyMatchV2, true, CaseSmart, false, true,
+			true, []Range{}, Delimiter{}, runes)
+	}, true, false, util.NewEventBox())
+	term := &Terminal{
+		multi:          true,
+		selected:       make(map[int32]selectedItem),
+		merger:         PassMerger(&chunks, false),
+		patternBuilder: matcher.patternBuilder}
+
+	// Both build patterns with the shared cache
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < 100; i++ {
+			matcher.Reset(chunks, []rune("foo"+strconv.Itoa(i)), false, false, true)
+		}
+		close(done)
+	}()
+	for i := 0; i < 100; i++ {
+		term.selectMatching("bar" + strconv.Itoa(i))
+	}
+	<-done
+}
+
+func TestSelectedView(t *testing.T) {
+	var index int32
+	chunkList := NewChunkList(func(item *Item, data []byte) bool {
+		item.text = util.ToChars(data)
+		item.text.Index = index
+		index++
+		return true
+	})
+	for _, line := range []string{"foo", "bar", "baz", "foobar", "qux"} {
+		chunkList.Push([]byte(line))
+	}
+	chunks, _ := chunkList.Snapshot()
+	items := []*Item{}
+	for _, chunk := range chunks {
+		for i := 0; i < chunk.count; i++ {
+			items = append(items, &chunk.items[i])
+		}
+	}
+	pattern := BuildPattern(true, algo.FuzzyMatchV2, true, CaseSmart, false, true,
+		false, []Range{}, Delimiter{}, []rune("foo"))
+	results := []Result{}
+	for _, item := range items {
+		if result, _, _ := pattern.MatchItem(item, false, util.MakeSlab(slab16Size, slab32Size)); result != nil {
+			results = append(results, *result)
+		}
+	}
+	term := &Terminal{
+		multi:    true,
+		selected: make(map[int32]selectedItem),
+		merger:   NewMerger(pattern, [][]Result{results}, false, false),
+		reqBox:   util.NewEventBox()}
+	now := time.Now()
+	for idx, i := range []int{4, 0, 2} {
+		term.selected[int32(i)] = selectedItem{now.Add(time.Duration(idx)), items[i]}
+	}
+	list := func() string {
+		strs := []string{}
+		for i := 0; i < term.merger.Length(); i++ {
+			strs = append(strs, term.merger.Get(i).item.AsString(false))
+		}
+		return strings.Join(strs, ",")
+	}
+	if hidden := term.hiddenSelected(); hidden != 2 {
+		t.Errorf("qux and baz should be hidden: %d", hidden)
+	}
+
+	term.toggleSelectedView()
+	if list() != "qux,foo,baz" || term.currentItem() != items[0] {
+		t.Errorf("invalid selected view: %s", list())
+	}
+	if hidden := term.hiddenSelected(); hidden != 2 {
+		t.Errorf("hidden items should be counted on the selected view: %d", hidden)
+	}
+	term.viewByIndex = true
+	term.viewVersion = -1
+	term.updateSelectedView()
+	if list() != "foo,baz,qux" {
+		t.Errorf("invalid selected view: %s", list())
+	}
+
+	// Deselected items are removed from the view, and the new result is
+	// shown when the view is closed
+	term.deselectItem(items[2])
+	term.updateSelectedView()
+	term.UpdateList(NewMerger(pattern, [][]Result{results[:1]}, false, false))
+	if list() != "foo,qux" {
+		t.Errorf("invalid selected view: %s", list())
+	}
+	if hidden := term.hiddenSelected(); hidden != 1 {
+		t.Errorf("qux should be hidden: %d", hidden)
+	}
+	term.toggleSelectedView()
+	if list() != "foo" || term.listMerger != nil {
+		t.Errorf("invalid list: %s", list())
+	}
+}
+
+func TestMoveSelectedAndPrintOrder(t *testing.T) {
+	var index int32
+	chunkList := NewChunkList(func(item *Item, data []byte) bool {
+		item.text = util.ToChars(data)
+		item.text.Index = index
+		index++
+		return true
+	})
+	for _, line := range []string{"foo", "bar", "baz", "foobar"} {
+		chunkList.Push([]byte(line))
+	}
+	chunks, _ := chunkList.Snapshot()
+	output := []string{}
+	term := &Terminal{
+		multi:    true,
+		selected: make(map[int32]selectedItem),
+		merger:   PassMerger(&chunks, false),
+		printer:  func(str string) { output = append(output, str) }}
+	now := time.Now()
+	for idx, i := range []int{3, 0, 2} {
+		term.selected[int32(i)] = selectedItem{now.Add(time.Duration(idx)), term.merger.Get(i).item}
+	}
+	check := func(order printOrder, expected string) {
+		output = []string{}
+		term.printOrder = order
+		term.output()
+		if strings.Join(output, ",") != expected {
+			t.Errorf("invalid output for %d: %v", order, output)
+		}
+	}
+	check(printOrderSelection, "foobar,foo,baz")
+	check(printOrderIndex, "foo,baz,foobar")
+
+	// Items in the order of the list followed by the hidden ones
+	pattern := BuildPattern(true, algo.FuzzyMatchV2, true, CaseSmart, false, true,
+		false, []Range{}, Delimiter{}, []rune("ba"))
+	results := []Result{}
+	for _, i := range []int{2, 1} {
+		item := term.merger.Get(i).item
+		result, _, _ := pattern.MatchItem(item, false, util.MakeSlab(slab16Size, slab32Size))
+		results = append(results, *result)
+	}
+	term.merger = NewMerger(pattern, [][]Result{results}, false, false)
+	check(printOrderScore, "baz,foobar,foo")
+
+	// Move baz before foo on the selected view
+	term.toggleSelectedView()
+	term.vset(2)
+	term.moveSelected(-1)
+	check(printOrderSelection, "foobar,baz,foo")
+	if term.cy != 1 || term.currentItem().AsString(false) != "baz" {
+		t.Errorf("cursor should follow the item: %d", term.cy)
+	}
+	term.moveSelected(-1)
+	term.moveSelected(-1)
+	check(printOrderSelection, "baz,foobar,foo")
+
+	// Not selected
+	term.toggleSelectedView()
+	term.vset(1)
+	term.moveSelected(1)
+	check(printOrderSelection, "baz,foobar,foo")
+}
+
+func TestSetFailure(t *testing.T) {
+	term := &Terminal{reqBox: util.NewEventBox()}
+	term.setFailure(2, "\n  no such file\nsecond line\n")
+	if term.failure != "[exit 2] no such file" {
+		t.Errorf("invalid failure: %q", term.failure)
+	}
+	term.setFailure(-1, "")
+	if term.failure != "[failed]" || time.Since(term.failureAt) > failureDuration {
+		t.Errorf("invalid failure: %q", term.failure)
+	}
+}
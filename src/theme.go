@@ -0,0 +1,95 @@
+package fzf
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Names of the base color schemes built into fzf
+var builtinThemes = []string{"dark", "light", "16", "bw"}
+
+// themeDirs returns the directories to look for theme files in the order of
+// precedence
+func themeDirs() []string {
+	dirs := []string{}
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if len(config) == 0 {
+		if home := os.Getenv("HOME"); len(home) > 0 {
+			config = filepath.Join(home, ".config")
+		}
+	}
+	if len(config) > 0 {
+		dirs = append(dirs, filepath.Join(config, "fzf", "themes"))
+	}
+	return dirs
+}
+
+// findTheme returns the path to the theme file of the given name. A name
+// containing a path separator is regarded as the path to the file.
+func findTheme(name string) (string, error) {
+	if strings.ContainsRune(name, '/') || strings.ContainsRune(name, filepath.Separator) {
+		return name, nil
+	}
+	for _, dir := range themeDirs() {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", errors.New("theme not found: " + name)
+}
+
+// readTheme reads the theme file and returns the color specification in it.
+// Each line of the file contains one or more comma-separated specifications
+// in the format of --color. Blank lines and lines starting with # are
+// ignored.
+func readTheme(name string) (string, error) {
+	path, err := findTheme(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.New("failed to read theme file: " + err.Error())
+	}
+	specs := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, spec := range strings.Split(line, ",") {
+			if spec = strings.TrimSpace(spec); len(spec) > 0 {
+				specs = append(specs, spec)
+			}
+		}
+	}
+	return strings.Join(specs, ","), nil
+}
+
+// listThemes returns the names of the built-in color schemes followed by the
+// sorted names of the theme files found in the theme directories
+func listThemes() []string {
+	found := make(map[string]bool)
+	names := []string{}
+	for _, dir := range themeDirs() {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			name := file.Name()
+			if file.IsDir() || strings.HasPrefix(name, ".") || found[name] {
+				continue
+			}
+			found[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append(append([]string{}, builtinThemes...), names...)
+}
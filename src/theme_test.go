@@ -0,0 +1,50 @@
+package fzf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/junegunn/fzf/src/tui"
+)
+
+func TestThemeFiles(t *testing.T) {
+	config, _ := ioutil.TempDir("", "fzf-theme")
+	defer os.RemoveAll(config)
+	if orig, found := os.LookupEnv("XDG_CONFIG_HOME"); found {
+		defer os.Setenv("XDG_CONFIG_HOME", orig)
+	} else {
+		defer os.Unsetenv("XDG_CONFIG_HOME")
+	}
+	os.Setenv("XDG_CONFIG_HOME", config)
+
+	dir := filepath.Join(config, "fzf", "themes")
+	os.MkdirAll(dir, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "Solar"), []byte(`
+# Base scheme
+light
+
+hl:#ff0000:underline, fg+:21
+prompt:bold
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, ".hidden"), []byte("dark"), 0644)
+
+	spec, err := readTheme("Solar")
+	if err != nil || spec != "light,hl:#ff0000:underline,fg+:21,prompt:bold" {
+		t.Errorf("invalid theme spec: %s (%v)", spec, err)
+	}
+
+	if names := listThemes(); strings.Join(names, ",") != "dark,light,16,bw,Solar" {
+		t.Errorf("invalid themes: %v", names)
+	}
+
+	// Overrides on top of the theme
+	theme := parseTheme(tui.Dark256, "theme:Solar,fg+:22")
+	if theme.Bg != tui.Light256.Bg || theme.Current.Color != 22 ||
+		theme.Match.Color != tui.HexToColor("#ff0000") || theme.Match.Attr != tui.Underline ||
+		theme.Prompt.Color != tui.Light256.Prompt.Color || theme.Prompt.Attr != tui.Bold {
+		t.Errorf("theme not applied: %v", theme)
+	}
+}
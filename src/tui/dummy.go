@@ -4,6 +4,8 @@
 
 package tui
 
+import "time"
+
 type Attr int
 
 func HasFullscreenRenderer() bool {
@@ -23,6 +25,8 @@ const (
 	Blink            = Attr(1 << 4)
 	Blink2           = Attr(1 << 5)
 	Reverse          = Attr(1 << 6)
+	StrikeThrough    = Attr(1 << 7)
+	AttrUndefined    = Attr(1 << 8)
 )
 
 func (r *FullscreenRenderer) Init()       {}
@@ -39,6 +43,10 @@ func (r *FullscreenRenderer) MaxY() int          { return 0 }
 
 func (r *FullscreenRenderer) RefreshWindows(windows []Window) {}
 
-func (r *FullscreenRenderer) NewWindow(top int, left int, width int, height int, borderStyle BorderStyle) Window {
+func (r *FullscreenRenderer) GetCharTimeout(timeout time.Duration) (Event, bool) {
+	return Event{}, false
+}
+
+func (r *FullscreenRenderer) NewWindow(top int, left int, width int, height int, preview bool, borderStyle BorderStyle) Window {
 	return nil
 }
@@ -1,6 +1,7 @@
 package tui
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"os/exec"
@@ -28,6 +29,9 @@ const (
 const consoleDevice string = "/dev/tty"
 
 var offsetRegexp *regexp.Regexp = regexp.MustCompile("\x1b\\[([0-9]+);([0-9]+)R")
+var keyboardFlagsRegexp *regexp.Regexp = regexp.MustCompile("\x1b\\[\\?[0-9]*u")
+var deviceAttrsRegexp *regexp.Regexp = regexp.MustCompile("\x1b\\[\\?[0-9;]*c")
+var pasteEnd []byte = []byte("\x1b[201~")
 
 func openTtyIn() *os.File {
 	in, err := os.OpenFile(consoleDevice, syscall.O_RDONLY, 0)
@@ -88,6 +92,7 @@ type LightRenderer struct {
 	escDelay      int
 	fullscreen    bool
 	upOneLine     bool
+	kittyKeys     bool
 	queued        string
 	y             int
 	x             int
@@ -97,6 +102,7 @@ type LightRenderer struct {
 type LightWindow struct {
 	renderer *LightRenderer
 	colored  bool
+	preview  bool
 	border   BorderStyle
 	top      int
 	left     int
@@ -120,6 +126,7 @@ func NewLightRenderer(theme *ColorTheme, forceBlack bool, mouse bool, tabstop in
 		tabstop:       tabstop,
 		fullscreen:    fullscreen,
 		upOneLine:     false,
+		kittyKeys:     false,
 		maxHeightFunc: maxHeightFunc}
 	return &r
 }
@@ -153,6 +160,56 @@ func (r *LightRenderer) findOffset() (row int, col int) {
 	return -1, -1
 }
 
+// detectKeyboardProtocol checks if the terminal supports the kitty keyboard
+// protocol. The terminals without the support only respond to the primary
+// device attributes request that follows the query.
+func (r *LightRenderer) detectKeyboardProtocol() bool {
+	r.csi("?u")
+	r.csi("c")
+	r.flush()
+	return r.readKeyboardProtocolReply()
+}
+
+// readKeyboardProtocolReply reads the replies to the requests until the
+// device attributes arrive so that they are not processed as keys. The other
+// input is left in the buffer.
+func (r *LightRenderer) readKeyboardProtocolReply() bool {
+	supported := false
+	for tries := 0; ; tries++ {
+		if loc := keyboardFlagsRegexp.FindIndex(r.buffer); loc != nil {
+			supported = true
+			r.buffer = append(r.buffer[:loc[0]], r.buffer[loc[1]:]...)
+		}
+		if loc := deviceAttrsRegexp.FindIndex(r.buffer); loc != nil {
+			r.buffer = append(r.buffer[:loc[0]], r.buffer[loc[1]:]...)
+			return supported
+		}
+		if tries == offsetPollTries {
+			return supported
+		}
+		// Do not block as not all terminals respond to the requests
+		if c, ok := r.getch(true); ok {
+			r.buffer = r.appendBytes(r.buffer, c, true)
+		} else {
+			time.Sleep(time.Duration(r.escDelay) * time.Millisecond)
+		}
+	}
+}
+
+// enableKeyboardProtocol pushes the flag for disambiguating escape codes
+// onto the stack of the kitty keyboard protocol
+func (r *LightRenderer) enableKeyboardProtocol() {
+	if r.kittyKeys {
+		r.csi(">1u")
+	}
+}
+
+func (r *LightRenderer) disableKeyboardProtocol() {
+	if r.kittyKeys {
+		r.csi("<u")
+	}
+}
+
 func repeat(s string, times int) string {
 	if times > 0 {
 		return strings.Repeat(s, times)
@@ -206,7 +263,11 @@ func (r *LightRenderer) Init() {
 
 	if r.mouse {
 		r.csi("?1000h")
+		r.csi("?1002h")
 	}
+	r.csi("?2004h")
+	r.kittyKeys = r.detectKeyboardProtocol()
+	r.enableKeyboardProtocol()
 	r.csi(fmt.Sprintf("%dA", r.MaxY()-1))
 	r.csi("G")
 	r.csi("K")
@@ -282,15 +343,20 @@ func (r *LightRenderer) getBytesInternal(buffer []byte, nonblock bool) []byte {
 		r.Close()
 		errorExit("Failed to read " + consoleDevice)
 	}
+	return r.appendBytes(buffer, c, c == ESC || nonblock)
+}
 
+// appendBytes appends the byte and the following bytes available. If wait is
+// true, waits up to escDelay for the rest of the escape sequence.
+func (r *LightRenderer) appendBytes(buffer []byte, c int, wait bool) []byte {
 	retries := 0
-	if c == ESC || nonblock {
+	if wait {
 		retries = r.escDelay / escPollInterval
 	}
 	buffer = append(buffer, byte(c))
 
 	for {
-		c, ok = r.getch(true)
+		c, ok := r.getch(true)
 		if !ok {
 			if retries > 0 {
 				retries--
@@ -306,6 +372,21 @@ func (r *LightRenderer) getBytesInternal(buffer []byte, nonblock bool) []byte {
 	return buffer
 }
 
+func (r *LightRenderer) GetCharTimeout(timeout time.Duration) (Event, bool) {
+	if len(r.buffer) == 0 {
+		c, ok := r.getch(true)
+		for retries := int(timeout / (escPollInterval * time.Millisecond)); !ok && retries > 0; retries-- {
+			time.Sleep(escPollInterval * time.Millisecond)
+			c, ok = r.getch(true)
+		}
+		if !ok {
+			return Event{Type: Invalid}, false
+		}
+		r.buffer = r.appendBytes(r.buffer, c, c == ESC)
+	}
+	return r.GetChar(), true
+}
+
 func (r *LightRenderer) GetChar() Event {
 	if len(r.buffer) == 0 {
 		r.buffer = r.getBytes()
@@ -319,18 +400,7 @@ func (r *LightRenderer) GetChar() Event {
 		r.buffer = r.buffer[sz:]
 	}()
 
-	switch r.buffer[0] {
-	case CtrlC:
-		return Event{CtrlC, 0, nil}
-	case CtrlG:
-		return Event{CtrlG, 0, nil}
-	case CtrlQ:
-		return Event{CtrlQ, 0, nil}
-	case 127:
-		return Event{BSpace, 0, nil}
-	case 0:
-		return Event{CtrlSpace, 0, nil}
-	case ESC:
+	if r.buffer[0] == ESC {
 		ev := r.escSequence(&sz)
 		// Second chance
 		if ev.Type == Invalid {
@@ -339,159 +409,215 @@ func (r *LightRenderer) GetChar() Event {
 		}
 		return ev
 	}
-
-	// CTRL-A ~ CTRL-Z
-	if r.buffer[0] <= CtrlZ {
-		return Event{int(r.buffer[0]), 0, nil}
+	if ev, ok := controlKey(r.buffer[0]); ok {
+		return ev
 	}
 	char, rsz := utf8.DecodeRune(r.buffer)
 	if char == utf8.RuneError {
-		return Event{ESC, 0, nil}
+		return Event{Type: ESC}
 	}
 	sz = rsz
-	return Event{Rune, char, nil}
+	return Event{Type: Rune, Char: char}
+}
+
+// controlKey returns the event for the ASCII control character
+func controlKey(b byte) (Event, bool) {
+	switch {
+	case b == 0:
+		return Event{Type: CtrlSpace}, true
+	case b <= CtrlZ:
+		// CTRL-A ~ CTRL-Z
+		return Event{Type: int(b)}, true
+	case b >= 28 && b <= 31:
+		// CTRL-\, CTRL-], CTRL-^, CTRL-/
+		return Event{Type: Rune, Char: []rune{'\\', ']', '^', '/'}[b-28], Mod: ModCtrl}, true
+	case b == 127:
+		return Event{Type: BSpace}, true
+	}
+	return Event{}, false
+}
+
+// xtermModifier decodes the modifier parameter of xterm escape sequences
+func xtermModifier(param string) Modifier {
+	// Strip the event type of the kitty keyboard protocol (e.g. 5:1)
+	bits, err := strconv.Atoi(strings.SplitN(param, ":", 2)[0])
+	if err != nil || bits < 1 {
+		return 0
+	}
+	bits--
+	mod := Modifier(0)
+	if bits&1 > 0 {
+		mod |= ModShift
+	}
+	if bits&(2|8) > 0 {
+		mod |= ModAlt
+	}
+	if bits&4 > 0 {
+		mod |= ModCtrl
+	}
+	return mod
+}
+
+// codepointKey returns the event for the Unicode code point of the key with
+// the modifiers
+func codepointKey(code int, mod Modifier) Event {
+	var key Key
+	switch code {
+	case 9:
+		key = KeyOf(Tab)
+	case 13:
+		key = KeyOf(CtrlM)
+	case 27:
+		key = KeyOf(ESC)
+	case 127:
+		key = KeyOf(BSpace)
+	default:
+		// Functional keys of the kitty protocol are in the private use area
+		if code < 32 || code > utf8.MaxRune || code >= 0xe000 && code <= 0xf8ff {
+			return Event{Type: Invalid}
+		}
+		key = RuneKey(rune(code), 0)
+	}
+	key = WithModifiers(key, mod)
+	return Event{Type: key.Type, Char: key.Char, Mod: key.Mod}
 }
 
 func (r *LightRenderer) escSequence(sz *int) Event {
 	if len(r.buffer) < 2 {
-		return Event{ESC, 0, nil}
+		return Event{Type: ESC}
 	}
 	*sz = 2
-	if r.buffer[1] >= 1 && r.buffer[1] <= 'z'-'a'+1 {
-		return Event{int(CtrlAltA + r.buffer[1] - 1), 0, nil}
-	}
 	switch r.buffer[1] {
-	case 32:
-		return Event{AltSpace, 0, nil}
-	case 47:
-		return Event{AltSlash, 0, nil}
-	case 98:
-		return Event{AltB, 0, nil}
-	case 100:
-		return Event{AltD, 0, nil}
-	case 102:
-		return Event{AltF, 0, nil}
-	case 127:
-		return Event{AltBS, 0, nil}
+	case ESC:
+		return Event{Type: Invalid}
 	case 91, 79:
 		if len(r.buffer) < 3 {
-			return Event{Invalid, 0, nil}
+			return Event{Type: Invalid}
 		}
-		*sz = 3
-		switch r.buffer[2] {
-		case 68:
-			return Event{Left, 0, nil}
-		case 67:
-			return Event{Right, 0, nil}
-		case 66:
-			return Event{Down, 0, nil}
-		case 65:
-			return Event{Up, 0, nil}
-		case 90:
-			return Event{BTab, 0, nil}
-		case 72:
-			return Event{Home, 0, nil}
-		case 70:
-			return Event{End, 0, nil}
-		case 77:
+		if r.buffer[1] == 91 && r.buffer[2] == 77 {
+			*sz = 3
 			return r.mouseSequence(sz)
-		case 80:
-			return Event{F1, 0, nil}
-		case 81:
-			return Event{F2, 0, nil}
-		case 82:
-			return Event{F3, 0, nil}
-		case 83:
-			return Event{F4, 0, nil}
-		case 49, 50, 51, 52, 53, 54:
-			if len(r.buffer) < 4 {
-				return Event{Invalid, 0, nil}
-			}
-			*sz = 4
-			switch r.buffer[2] {
-			case 50:
-				if len(r.buffer) == 5 && r.buffer[4] == 126 {
-					*sz = 5
-					switch r.buffer[3] {
-					case 48:
-						return Event{F9, 0, nil}
-					case 49:
-						return Event{F10, 0, nil}
-					case 51:
-						return Event{F11, 0, nil}
-					case 52:
-						return Event{F12, 0, nil}
-					}
-				}
-				// Bracketed paste mode: \e[200~ ... \e[201~
-				if r.buffer[3] == '0' && (r.buffer[4] == '0' || r.buffer[4] == '1') && r.buffer[5] == '~' {
-					// Immediately discard the sequence from the buffer and reread input
-					r.buffer = r.buffer[6:]
-					*sz = 0
-					return r.GetChar()
+		}
+		return r.csiSequence(sz)
+	}
+
+	// Alt + key
+	if ev, ok := controlKey(r.buffer[1]); ok {
+		ev.Mod |= ModAlt
+		return ev
+	}
+	char, rsz := utf8.DecodeRune(r.buffer[1:])
+	if char == utf8.RuneError {
+		return Event{Type: Invalid}
+	}
+	*sz = 1 + rsz
+	return Event{Type: Rune, Char: char, Mod: ModAlt}
+}
+
+// csiSequence parses CSI (ESC [) and SS3 (ESC O) sequences of the form
+// ESC [ PARAMS FINAL where PARAMS is a semicolon-separated list of numbers
+func (r *LightRenderer) csiSequence(sz *int) Event {
+	end := 2
+	for end < len(r.buffer) && r.buffer[end] >= 0x20 && r.buffer[end] <= 0x3f {
+		end++
+	}
+	if end >= len(r.buffer) || r.buffer[end] < 0x40 || r.buffer[end] > 0x7e {
+		return Event{Type: Invalid}
+	}
+	*sz = end + 1
+	params := strings.Split(string(r.buffer[2:end]), ";")
+	mod := Modifier(0)
+	if len(params) > 1 {
+		mod = xtermModifier(params[1])
+	}
+	key := func(keyType int) Event {
+		return Event{Type: keyType, Mod: mod}
+	}
+
+	switch r.buffer[end] {
+	case 'A':
+		return key(Up)
+	case 'B':
+		return key(Down)
+	case 'C':
+		return key(Right)
+	case 'D':
+		return key(Left)
+	case 'H':
+		return key(Home)
+	case 'F':
+		return key(End)
+	case 'P', 'Q', 'R', 'S':
+		return key(F1 + int(r.buffer[end]-'P'))
+	case 'Z':
+		mod &^= ModShift
+		return key(BTab)
+	case 'u':
+		// CSI code ; modifiers u (fixterms, kitty keyboard protocol)
+		// The code may be followed by alternate key codes (e.g. 97:65)
+		code, err := strconv.Atoi(strings.SplitN(params[0], ":", 2)[0])
+		if err != nil {
+			return Event{Type: Invalid}
+		}
+		return codepointKey(code, mod)
+	case '~':
+		num, _ := strconv.Atoi(params[0])
+		switch num {
+		case 27:
+			// CSI 27 ; modifiers ; code ~ (xterm modifyOtherKeys)
+			if len(params) > 2 {
+				if code, err := strconv.Atoi(params[2]); err == nil {
+					return codepointKey(code, mod)
 				}
-				return Event{Invalid, 0, nil} // INS
-			case 51:
-				return Event{Del, 0, nil}
-			case 52:
-				return Event{End, 0, nil}
-			case 53:
-				return Event{PgUp, 0, nil}
-			case 54:
-				return Event{PgDn, 0, nil}
-			case 49:
-				switch r.buffer[3] {
-				case 126:
-					return Event{Home, 0, nil}
-				case 53, 55, 56, 57:
-					if len(r.buffer) == 5 && r.buffer[4] == 126 {
-						*sz = 5
-						switch r.buffer[3] {
-						case 53:
-							return Event{F5, 0, nil}
-						case 55:
-							return Event{F6, 0, nil}
-						case 56:
-							return Event{F7, 0, nil}
-						case 57:
-							return Event{F8, 0, nil}
-						}
-					}
-					return Event{Invalid, 0, nil}
-				case 59:
-					if len(r.buffer) != 6 {
-						return Event{Invalid, 0, nil}
-					}
-					*sz = 6
-					switch r.buffer[4] {
-					case 50:
-						switch r.buffer[5] {
-						case 68:
-							return Event{Home, 0, nil}
-						case 67:
-							return Event{End, 0, nil}
-						}
-					case 53:
-						switch r.buffer[5] {
-						case 68:
-							return Event{SLeft, 0, nil}
-						case 67:
-							return Event{SRight, 0, nil}
-						}
-					} // r.buffer[4]
-				} // r.buffer[3]
-			} // r.buffer[2]
-		} // r.buffer[2]
-	} // r.buffer[1]
-	if r.buffer[1] >= 'a' && r.buffer[1] <= 'z' {
-		return Event{AltA + int(r.buffer[1]) - 'a', 0, nil}
-	}
-	return Event{Invalid, 0, nil}
+			}
+			return Event{Type: Invalid}
+		case 1, 7:
+			return key(Home)
+		case 2:
+			return key(Insert)
+		case 3:
+			return key(Del)
+		case 4, 8:
+			return key(End)
+		case 5:
+			return key(PgUp)
+		case 6:
+			return key(PgDn)
+		case 11, 12, 13, 14, 15:
+			return key(F1 + num - 11)
+		case 17, 18, 19, 20, 21:
+			return key(F6 + num - 17)
+		case 23, 24:
+			return key(F11 + num - 23)
+		case 200:
+			return r.pasteSequence(sz)
+		case 201:
+			// Stray end of bracketed paste. Discard the sequence from the
+			// buffer and reread input.
+			r.buffer = r.buffer[*sz:]
+			*sz = 0
+			return r.GetChar()
+		}
+	}
+	return Event{Type: Invalid}
+}
+
+// pasteSequence reads the text of bracketed paste (\e[200~ ... \e[201~) as a
+// single event
+func (r *LightRenderer) pasteSequence(sz *int) Event {
+	start := *sz
+	for {
+		if idx := bytes.Index(r.buffer[start:], pasteEnd); idx >= 0 {
+			*sz = start + idx + len(pasteEnd)
+			return Event{Type: Paste, Text: string(r.buffer[start : start+idx])}
+		}
+		r.buffer = r.getBytesInternal(r.buffer, false)
+	}
 }
 
 func (r *LightRenderer) mouseSequence(sz *int) Event {
 	if len(r.buffer) < 6 || !r.mouse {
-		return Event{Invalid, 0, nil}
+		return Event{Type: Invalid}
 	}
 	*sz = 6
 	switch r.buffer[3] {
@@ -520,16 +646,21 @@ func (r *LightRenderer) mouseSequence(sz *int) Event {
 			}
 		}
 
-		return Event{Mouse, 0, &MouseEvent{y, x, 0, left, down, double, mod}}
+		return Event{Type: Mouse, MouseEvent: &MouseEvent{y, x, 0, left, down, double, mod, false}}
+	case 64, 68, 72, 80: // left-drag / shift / cmd / ctrl
+		mod := r.buffer[3] != 64
+		x := int(r.buffer[4] - 33)
+		y := int(r.buffer[5]-33) - r.yoffset
+		return Event{Type: Mouse, MouseEvent: &MouseEvent{y, x, 0, true, true, false, mod, true}}
 	case 96, 100, 104, 112, // scroll-up / shift / cmd / ctrl
 		97, 101, 105, 113: // scroll-down / shift / cmd / ctrl
 		mod := r.buffer[3] >= 100
 		s := 1 - int(r.buffer[3]%2)*2
 		x := int(r.buffer[4] - 33)
 		y := int(r.buffer[5]-33) - r.yoffset
-		return Event{Mouse, 0, &MouseEvent{y, x, s, false, false, false, mod}}
+		return Event{Type: Mouse, MouseEvent: &MouseEvent{y, x, s, false, false, false, mod, false}}
 	}
-	return Event{Invalid, 0, nil}
+	return Event{Type: Invalid}
 }
 
 func (r *LightRenderer) smcup() {
@@ -541,6 +672,9 @@ func (r *LightRenderer) rmcup() {
 }
 
 func (r *LightRenderer) Pause(clear bool) {
+	r.disableKeyboardProtocol()
+	r.csi("?2004l")
+	r.flush()
 	terminal.Restore(r.fd(), r.origState)
 	if clear {
 		if r.fullscreen {
@@ -555,6 +689,8 @@ func (r *LightRenderer) Pause(clear bool) {
 
 func (r *LightRenderer) Resume(clear bool) {
 	terminal.MakeRaw(r.fd())
+	r.csi("?2004h")
+	r.enableKeyboardProtocol()
 	if clear {
 		if r.fullscreen {
 			r.smcup()
@@ -566,6 +702,7 @@ func (r *LightRenderer) Resume(clear bool) {
 		// NOTE: Resume(false) is only called on SIGCONT after SIGSTOP.
 		// And It's highly likely that the offset we obtained at the beginning will
 		// no longer be correct, so we simply disable mouse input.
+		r.csi("?1002l")
 		r.csi("?1000l")
 		r.mouse = false
 	}
@@ -605,8 +742,11 @@ func (r *LightRenderer) Close() {
 		r.csi("u")
 	}
 	if r.mouse {
+		r.csi("?1002l")
 		r.csi("?1000l")
 	}
+	r.disableKeyboardProtocol()
+	r.csi("?2004l")
 	r.flush()
 	terminal.Restore(r.fd(), r.origState)
 }
@@ -623,10 +763,11 @@ func (r *LightRenderer) DoesAutoWrap() bool {
 	return false
 }
 
-func (r *LightRenderer) NewWindow(top int, left int, width int, height int, borderStyle BorderStyle) Window {
+func (r *LightRenderer) NewWindow(top int, left int, width int, height int, preview bool, borderStyle BorderStyle) Window {
 	w := &LightWindow{
 		renderer: r,
 		colored:  r.theme != nil,
+		preview:  preview,
 		border:   borderStyle,
 		top:      top,
 		left:     left,
@@ -636,8 +777,13 @@ func (r *LightRenderer) NewWindow(top int, left int, width int, height int, bord
 		fg:       colDefault,
 		bg:       colDefault}
 	if r.theme != nil {
-		w.fg = r.theme.Fg
-		w.bg = r.theme.Bg
+		if preview {
+			w.fg = r.theme.PreviewFg.Color
+			w.bg = r.theme.PreviewBg.Color
+		} else {
+			w.fg = r.theme.Fg.Color
+			w.bg = r.theme.Bg.Color
+		}
 	}
 	w.drawBorder()
 	return w
@@ -652,24 +798,31 @@ func (w *LightWindow) drawBorder() {
 	}
 }
 
+func (w *LightWindow) borderColor() ColorPair {
+	if w.preview {
+		return ColPreviewBorder
+	}
+	return ColBorder
+}
+
 func (w *LightWindow) drawBorderHorizontal() {
 	w.Move(0, 0)
-	w.CPrint(ColBorder, AttrRegular, repeat("─", w.width))
+	w.CPrint(w.borderColor(), AttrRegular, repeat("─", w.width))
 	w.Move(w.height-1, 0)
-	w.CPrint(ColBorder, AttrRegular, repeat("─", w.width))
+	w.CPrint(w.borderColor(), AttrRegular, repeat("─", w.width))
 }
 
 func (w *LightWindow) drawBorderAround() {
 	w.Move(0, 0)
-	w.CPrint(ColBorder, AttrRegular, "┌"+repeat("─", w.width-2)+"┐")
+	w.CPrint(w.borderColor(), AttrRegular, "┌"+repeat("─", w.width-2)+"┐")
 	for y := 1; y < w.height-1; y++ {
 		w.Move(y, 0)
-		w.CPrint(ColBorder, AttrRegular, "│")
+		w.CPrint(w.borderColor(), AttrRegular, "│")
 		w.cprint2(colDefault, w.bg, AttrRegular, repeat(" ", w.width-2))
-		w.CPrint(ColBorder, AttrRegular, "│")
+		w.CPrint(w.borderColor(), AttrRegular, "│")
 	}
 	w.Move(w.height-1, 0)
-	w.CPrint(ColBorder, AttrRegular, "└"+repeat("─", w.width-2)+"┘")
+	w.CPrint(w.borderColor(), AttrRegular, "└"+repeat("─", w.width-2)+"┘")
 }
 
 func (w *LightWindow) csi(code string) {
@@ -754,6 +907,9 @@ func attrCodes(attr Attr) []string {
 	if (attr & Reverse) > 0 {
 		codes = append(codes, "7")
 	}
+	if (attr & StrikeThrough) > 0 {
+		codes = append(codes, "9")
+	}
 	return codes
 }
 
@@ -763,6 +919,7 @@ func colorCodes(fg Color, bg Color) []string {
 		if c == colDefault {
 			return
 		}
+		c = c.degrade(colorDepth)
 		if c.is24() {
 			r := (c >> 16) & 0xff
 			g := (c >> 8) & 0xff
@@ -799,7 +956,7 @@ func (w *LightWindow) CPrint(pair ColorPair, attr Attr, text string) {
 	if !w.colored {
 		w.csiColor(colDefault, colDefault, attrFor(pair, attr))
 	} else {
-		w.csiColor(pair.Fg(), pair.Bg(), attr)
+		w.csiColor(pair.Fg(), pair.Bg(), attr.Merge(pair.Attr()))
 	}
 	w.stderrInternal(cleanse(text), false)
 	w.csi("m")
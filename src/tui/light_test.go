@@ -0,0 +1,109 @@
+package tui
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/junegunn/fzf/src/util"
+)
+
+func TestEscSequence(t *testing.T) {
+	check := func(input string, expected Key) {
+		r := &LightRenderer{buffer: []byte(input)}
+		ev := r.GetChar()
+		if ev.Key() != expected {
+			t.Errorf("%q: expected %v, actual %v", input, expected, ev.Key())
+		}
+		if len(r.buffer) != 0 {
+			t.Errorf("%q: %d bytes not consumed", input, len(r.buffer))
+		}
+	}
+	check("\x1b[A", KeyOf(Up))
+	check("\x1bOB", KeyOf(Down))
+	check("\x1b[1;5A", Key{Up, 0, ModCtrl})
+	check("\x1b[1;4B", Key{Down, 0, ModAlt | ModShift})
+	check("\x1b[1;2D", Key{Left, 0, ModShift})
+	check("\x1b[1;9C", Key{Right, 0, ModAlt})
+	check("\x1b[15;2~", Key{F5, 0, ModShift})
+	check("\x1b[24~", KeyOf(F12))
+	check("\x1b[1;5P", Key{F1, 0, ModCtrl})
+	check("\x1b[3;5~", Key{Del, 0, ModCtrl})
+	check("\x1b[5~", KeyOf(PgUp))
+	check("\x1b[Z", KeyOf(BTab))
+	check("\x1ba", RuneKey('a', ModAlt))
+	check("\x1b/", RuneKey('/', ModAlt))
+	check("\x1b\x01", Key{CtrlA, 0, ModAlt})
+	check("\x1b\x7f", Key{BSpace, 0, ModAlt})
+	check("\x1f", RuneKey('/', ModCtrl))
+	check("\x00", KeyOf(CtrlSpace))
+	check("가", RuneKey('가', 0))
+}
+
+func TestCSIu(t *testing.T) {
+	check := func(input string, expected Key) {
+		r := &LightRenderer{buffer: []byte(input)}
+		if ev := r.GetChar(); ev.Key() != expected {
+			t.Errorf("%q: expected %v, actual %v", input, expected, ev.Key())
+		}
+	}
+	check("\x1b[105;5u", RuneKey('i', ModCtrl))
+	check("\x1b[109;5u", RuneKey('m', ModCtrl))
+	check("\x1b[91;5u", RuneKey('[', ModCtrl))
+	check("\x1b[97;5u", KeyOf(CtrlA))
+	check("\x1b[97;7u", Key{CtrlA, 0, ModAlt})
+	check("\x1b[97;6u", Key{CtrlA, 0, ModShift})
+	check("\x1b[97:65;2u", RuneKey('A', 0))
+	check("\x1b[97;3:1u", RuneKey('a', ModAlt))
+	check("\x1b[9u", KeyOf(Tab))
+	check("\x1b[9;2u", KeyOf(BTab))
+	check("\x1b[13;3u", Key{CtrlM, 0, ModAlt})
+	check("\x1b[27u", KeyOf(ESC))
+	check("\x1b[32;5u", KeyOf(CtrlSpace))
+	check("\x1b[47;5u", RuneKey('/', ModCtrl))
+	check("\x1b[27;5;105~", RuneKey('i', ModCtrl))
+	if codepointKey(57399, 0).Type != Invalid {
+		t.Error("functional keys of kitty protocol should be ignored")
+	}
+}
+
+func TestBracketedPaste(t *testing.T) {
+	r := &LightRenderer{buffer: []byte("\x1b[200~foo\nbar\x1b[A\x1b[201~x")}
+	if ev := r.GetChar(); ev.Type != Paste || ev.Text != "foo\nbar\x1b[A" {
+		t.Errorf("invalid paste event: %v", ev)
+	}
+	if ev := r.GetChar(); ev.Key() != RuneKey('x', 0) || len(r.buffer) != 0 {
+		t.Errorf("invalid event after paste: %v", ev)
+	}
+}
+
+func TestGetCharTimeout(t *testing.T) {
+	if util.IsWindows() {
+		t.Skip("requires non-blocking read")
+	}
+	rd, wr, _ := os.Pipe()
+	defer rd.Close()
+	defer wr.Close()
+	r := &LightRenderer{ttyin: rd}
+	if _, ok := r.GetCharTimeout(20 * time.Millisecond); ok {
+		t.Error("should time out without input")
+	}
+	wr.Write([]byte("gx"))
+	if ev, ok := r.GetCharTimeout(20 * time.Millisecond); !ok || ev.Key() != RuneKey('g', 0) {
+		t.Errorf("invalid event: %v", ev)
+	}
+	if ev, ok := r.GetCharTimeout(20 * time.Millisecond); !ok || ev.Key() != RuneKey('x', 0) {
+		t.Errorf("invalid event: %v", ev)
+	}
+}
+
+func TestKeyboardProtocolReply(t *testing.T) {
+	r := &LightRenderer{buffer: []byte("\x1b[?0ux\x1b[?62;22c")}
+	if !r.readKeyboardProtocolReply() || string(r.buffer) != "x" {
+		t.Errorf("both replies should be consumed: %q", r.buffer)
+	}
+	r = &LightRenderer{buffer: []byte("\x1b[?62;22c")}
+	if r.readKeyboardProtocolReply() || len(r.buffer) != 0 {
+		t.Errorf("protocol should not be supported: %q", r.buffer)
+	}
+}
@@ -21,13 +21,14 @@ func HasFullscreenRenderer() bool {
 
 func (p ColorPair) style() tcell.Style {
 	style := tcell.StyleDefault
-	return style.Foreground(tcell.Color(p.Fg())).Background(tcell.Color(p.Bg()))
+	return style.Foreground(tcell.Color(p.Fg().degrade(colorDepth))).Background(tcell.Color(p.Bg().degrade(colorDepth)))
 }
 
 type Attr tcell.Style
 
 type TcellWindow struct {
 	color       bool
+	preview     bool
 	top         int
 	left        int
 	width       int
@@ -38,6 +39,13 @@ type TcellWindow struct {
 	borderStyle BorderStyle
 }
 
+func (w *TcellWindow) normal() ColorPair {
+	if w.preview {
+		return ColPreview
+	}
+	return ColNormal
+}
+
 func (w *TcellWindow) Top() int {
 	return w.top
 }
@@ -80,10 +88,12 @@ const (
 	Reverse        = Attr(tcell.AttrReverse)
 	Underline      = Attr(tcell.AttrUnderline)
 	Italic         = Attr(tcell.AttrNone) // Not supported
+	StrikeThrough  = Attr(tcell.AttrNone) // Not supported
 )
 
 const (
-	AttrRegular Attr = 0
+	AttrRegular   Attr = 0
+	AttrUndefined Attr = 1 << 31
 )
 
 func (r *FullscreenRenderer) defaultTheme() *ColorTheme {
@@ -181,11 +191,41 @@ func (r *FullscreenRenderer) Refresh() {
 	// noop
 }
 
+func (r *FullscreenRenderer) GetCharTimeout(timeout time.Duration) (Event, bool) {
+	// The interrupt of the timer that fired before it was stopped can be
+	// still in the queue, so it is tagged to be told from the later ones
+	r.timeouts++
+	gen := r.timeouts
+	timer := time.AfterFunc(timeout, func() {
+		_screen.PostEvent(tcell.NewEventInterrupt(gen))
+	})
+	defer timer.Stop()
+	for {
+		ev := _screen.PollEvent()
+		if ev, ok := ev.(*tcell.EventInterrupt); ok {
+			if ev.Data() == gen {
+				return Event{Type: Invalid}, false
+			}
+			continue
+		}
+		return r.convertEvent(ev), true
+	}
+}
+
 func (r *FullscreenRenderer) GetChar() Event {
-	ev := _screen.PollEvent()
+	for {
+		// Ignore the interrupts of the expired timers of GetCharTimeout
+		ev := _screen.PollEvent()
+		if _, ok := ev.(*tcell.EventInterrupt); !ok {
+			return r.convertEvent(ev)
+		}
+	}
+}
+
+func (r *FullscreenRenderer) convertEvent(ev tcell.Event) Event {
 	switch ev := ev.(type) {
 	case *tcell.EventResize:
-		return Event{Resize, 0, nil}
+		return Event{Type: Resize}
 
 	// process mouse events:
 	case *tcell.EventMouse:
@@ -193,9 +233,9 @@ func (r *FullscreenRenderer) GetChar() Event {
 		button := ev.Buttons()
 		mod := ev.Modifiers() != 0
 		if button&tcell.WheelDown != 0 {
-			return Event{Mouse, 0, &MouseEvent{y, x, -1, false, false, false, mod}}
+			return Event{Type: Mouse, MouseEvent: &MouseEvent{y, x, -1, false, false, false, mod, false}}
 		} else if button&tcell.WheelUp != 0 {
-			return Event{Mouse, 0, &MouseEvent{y, x, +1, false, false, false, mod}}
+			return Event{Type: Mouse, MouseEvent: &MouseEvent{y, x, +1, false, false, false, mod, false}}
 		} else if runtime.GOOS != "windows" {
 			// double and single taps on Windows don't quite work due to
 			// the console acting on the events and not allowing us
@@ -203,6 +243,11 @@ func (r *FullscreenRenderer) GetChar() Event {
 
 			left := button&tcell.Button1 != 0
 			down := left || button&tcell.Button3 != 0
+			drag := left && r.leftDown
+			r.leftDown = left
+			if drag {
+				return Event{Type: Mouse, MouseEvent: &MouseEvent{y, x, 0, true, true, false, mod, true}}
+			}
 			double := false
 			if down {
 				now := time.Now()
@@ -221,153 +266,155 @@ func (r *FullscreenRenderer) GetChar() Event {
 				}
 			}
 
-			return Event{Mouse, 0, &MouseEvent{y, x, 0, left, down, double, mod}}
+			return Event{Type: Mouse, MouseEvent: &MouseEvent{y, x, 0, left, down, double, mod, false}}
 		}
 
 		// process keyboard:
 	case *tcell.EventKey:
-		alt := (ev.Modifiers() & tcell.ModAlt) > 0
+		mods := ev.Modifiers()
+		mod := Modifier(0)
+		if mods&tcell.ModShift > 0 {
+			mod |= ModShift
+		}
+		if mods&(tcell.ModAlt|tcell.ModMeta) > 0 {
+			mod |= ModAlt
+		}
+		if mods&tcell.ModCtrl > 0 {
+			mod |= ModCtrl
+		}
+		// CTRL is implied by the control characters, and SHIFT by the
+		// characters themselves
+		alt := mod & ModAlt
 		keyfn := func(r rune) int {
-			if alt {
-				return CtrlAltA - 'a' + int(r)
-			}
 			return CtrlA - 'a' + int(r)
 		}
 		switch ev.Key() {
 		case tcell.KeyCtrlA:
-			return Event{keyfn('a'), 0, nil}
+			return Event{Type: keyfn('a'), Mod: alt}
 		case tcell.KeyCtrlB:
-			return Event{keyfn('b'), 0, nil}
+			return Event{Type: keyfn('b'), Mod: alt}
 		case tcell.KeyCtrlC:
-			return Event{keyfn('c'), 0, nil}
+			return Event{Type: keyfn('c'), Mod: alt}
 		case tcell.KeyCtrlD:
-			return Event{keyfn('d'), 0, nil}
+			return Event{Type: keyfn('d'), Mod: alt}
 		case tcell.KeyCtrlE:
-			return Event{keyfn('e'), 0, nil}
+			return Event{Type: keyfn('e'), Mod: alt}
 		case tcell.KeyCtrlF:
-			return Event{keyfn('f'), 0, nil}
+			return Event{Type: keyfn('f'), Mod: alt}
 		case tcell.KeyCtrlG:
-			return Event{keyfn('g'), 0, nil}
+			return Event{Type: keyfn('g'), Mod: alt}
 		case tcell.KeyCtrlH:
-			return Event{keyfn('h'), 0, nil}
+			return Event{Type: keyfn('h'), Mod: alt}
 		case tcell.KeyCtrlI:
-			return Event{keyfn('i'), 0, nil}
+			return Event{Type: keyfn('i'), Mod: alt}
 		case tcell.KeyCtrlJ:
-			return Event{keyfn('j'), 0, nil}
+			return Event{Type: keyfn('j'), Mod: alt}
 		case tcell.KeyCtrlK:
-			return Event{keyfn('k'), 0, nil}
+			return Event{Type: keyfn('k'), Mod: alt}
 		case tcell.KeyCtrlL:
-			return Event{keyfn('l'), 0, nil}
+			return Event{Type: keyfn('l'), Mod: alt}
 		case tcell.KeyCtrlM:
-			return Event{keyfn('m'), 0, nil}
+			return Event{Type: keyfn('m'), Mod: alt}
 		case tcell.KeyCtrlN:
-			return Event{keyfn('n'), 0, nil}
+			return Event{Type: keyfn('n'), Mod: alt}
 		case tcell.KeyCtrlO:
-			return Event{keyfn('o'), 0, nil}
+			return Event{Type: keyfn('o'), Mod: alt}
 		case tcell.KeyCtrlP:
-			return Event{keyfn('p'), 0, nil}
+			return Event{Type: keyfn('p'), Mod: alt}
 		case tcell.KeyCtrlQ:
-			return Event{keyfn('q'), 0, nil}
+			return Event{Type: keyfn('q'), Mod: alt}
 		case tcell.KeyCtrlR:
-			return Event{keyfn('r'), 0, nil}
+			return Event{Type: keyfn('r'), Mod: alt}
 		case tcell.KeyCtrlS:
-			return Event{keyfn('s'), 0, nil}
+			return Event{Type: keyfn('s'), Mod: alt}
 		case tcell.KeyCtrlT:
-			return Event{keyfn('t'), 0, nil}
+			return Event{Type: keyfn('t'), Mod: alt}
 		case tcell.KeyCtrlU:
-			return Event{keyfn('u'), 0, nil}
+			return Event{Type: keyfn('u'), Mod: alt}
 		case tcell.KeyCtrlV:
-			return Event{keyfn('v'), 0, nil}
+			return Event{Type: keyfn('v'), Mod: alt}
 		case tcell.KeyCtrlW:
-			return Event{keyfn('w'), 0, nil}
+			return Event{Type: keyfn('w'), Mod: alt}
 		case tcell.KeyCtrlX:
-			return Event{keyfn('x'), 0, nil}
+			return Event{Type: keyfn('x'), Mod: alt}
 		case tcell.KeyCtrlY:
-			return Event{keyfn('y'), 0, nil}
+			return Event{Type: keyfn('y'), Mod: alt}
 		case tcell.KeyCtrlZ:
-			return Event{keyfn('z'), 0, nil}
+			return Event{Type: keyfn('z'), Mod: alt}
 		case tcell.KeyCtrlSpace:
-			return Event{CtrlSpace, 0, nil}
+			return Event{Type: CtrlSpace, Mod: alt}
+		case tcell.KeyCtrlBackslash:
+			return Event{Type: Rune, Char: '\\', Mod: ModCtrl | alt}
+		case tcell.KeyCtrlRightSq:
+			return Event{Type: Rune, Char: ']', Mod: ModCtrl | alt}
+		case tcell.KeyCtrlCarat:
+			return Event{Type: Rune, Char: '^', Mod: ModCtrl | alt}
+		case tcell.KeyCtrlUnderscore:
+			return Event{Type: Rune, Char: '/', Mod: ModCtrl | alt}
 		case tcell.KeyBackspace2:
-			if alt {
-				return Event{AltBS, 0, nil}
-			}
-			return Event{BSpace, 0, nil}
+			return Event{Type: BSpace, Mod: alt}
 
 		case tcell.KeyUp:
-			return Event{Up, 0, nil}
+			return Event{Type: Up, Mod: mod}
 		case tcell.KeyDown:
-			return Event{Down, 0, nil}
+			return Event{Type: Down, Mod: mod}
 		case tcell.KeyLeft:
-			return Event{Left, 0, nil}
+			return Event{Type: Left, Mod: mod}
 		case tcell.KeyRight:
-			return Event{Right, 0, nil}
+			return Event{Type: Right, Mod: mod}
 
 		case tcell.KeyHome:
-			return Event{Home, 0, nil}
+			return Event{Type: Home, Mod: mod}
 		case tcell.KeyDelete:
-			return Event{Del, 0, nil}
+			return Event{Type: Del, Mod: mod}
+		case tcell.KeyInsert:
+			return Event{Type: Insert, Mod: mod}
 		case tcell.KeyEnd:
-			return Event{End, 0, nil}
+			return Event{Type: End, Mod: mod}
 		case tcell.KeyPgUp:
-			return Event{PgUp, 0, nil}
+			return Event{Type: PgUp, Mod: mod}
 		case tcell.KeyPgDn:
-			return Event{PgDn, 0, nil}
+			return Event{Type: PgDn, Mod: mod}
 
 		case tcell.KeyBacktab:
-			return Event{BTab, 0, nil}
+			return Event{Type: BTab}
 
 		case tcell.KeyF1:
-			return Event{F1, 0, nil}
+			return Event{Type: F1, Mod: mod}
 		case tcell.KeyF2:
-			return Event{F2, 0, nil}
+			return Event{Type: F2, Mod: mod}
 		case tcell.KeyF3:
-			return Event{F3, 0, nil}
+			return Event{Type: F3, Mod: mod}
 		case tcell.KeyF4:
-			return Event{F4, 0, nil}
+			return Event{Type: F4, Mod: mod}
 		case tcell.KeyF5:
-			return Event{F5, 0, nil}
+			return Event{Type: F5, Mod: mod}
 		case tcell.KeyF6:
-			return Event{F6, 0, nil}
+			return Event{Type: F6, Mod: mod}
 		case tcell.KeyF7:
-			return Event{F7, 0, nil}
+			return Event{Type: F7, Mod: mod}
 		case tcell.KeyF8:
-			return Event{F8, 0, nil}
+			return Event{Type: F8, Mod: mod}
 		case tcell.KeyF9:
-			return Event{F9, 0, nil}
+			return Event{Type: F9, Mod: mod}
 		case tcell.KeyF10:
-			return Event{F10, 0, nil}
+			return Event{Type: F10, Mod: mod}
 		case tcell.KeyF11:
-			return Event{F11, 0, nil}
+			return Event{Type: F11, Mod: mod}
 		case tcell.KeyF12:
-			return Event{F12, 0, nil}
+			return Event{Type: F12, Mod: mod}
 
 		// ev.Ch doesn't work for some reason for space:
 		case tcell.KeyRune:
-			r := ev.Rune()
-			if alt {
-				switch r {
-				case ' ':
-					return Event{AltSpace, 0, nil}
-				case '/':
-					return Event{AltSlash, 0, nil}
-				}
-				if r >= 'a' && r <= 'z' {
-					return Event{AltA + int(r) - 'a', 0, nil}
-				}
-				if r >= '0' && r <= '9' {
-					return Event{Alt0 + int(r) - '0', 0, nil}
-				}
-			}
-			return Event{Rune, r, nil}
+			return Event{Type: Rune, Char: ev.Rune(), Mod: alt}
 
 		case tcell.KeyEsc:
-			return Event{ESC, 0, nil}
+			return Event{Type: ESC}
 
 		}
 	}
 
-	return Event{Invalid, 0, nil}
+	return Event{Type: Invalid}
 }
 
 func (r *FullscreenRenderer) Pause(bool) {
@@ -390,10 +437,11 @@ func (r *FullscreenRenderer) RefreshWindows(windows []Window) {
 	_screen.Show()
 }
 
-func (r *FullscreenRenderer) NewWindow(top int, left int, width int, height int, borderStyle BorderStyle) Window {
+func (r *FullscreenRenderer) NewWindow(top int, left int, width int, height int, preview bool, borderStyle BorderStyle) Window {
 	// TODO
 	return &TcellWindow{
 		color:       r.theme != nil,
+		preview:     preview,
 		top:         top,
 		left:        left,
 		width:       width,
@@ -405,16 +453,16 @@ func (w *TcellWindow) Close() {
 	// TODO
 }
 
-func fill(x, y, w, h int, r rune) {
+func fill(x, y, w, h int, pair ColorPair, r rune) {
 	for ly := 0; ly <= h; ly++ {
 		for lx := 0; lx <= w; lx++ {
-			_screen.SetContent(x+lx, y+ly, r, nil, ColNormal.style())
+			_screen.SetContent(x+lx, y+ly, r, nil, pair.style())
 		}
 	}
 }
 
 func (w *TcellWindow) Erase() {
-	fill(w.left-1, w.top, w.width+1, w.height, ' ')
+	fill(w.left-1, w.top, w.width+1, w.height, w.normal(), ' ')
 }
 
 func (w *TcellWindow) Enclose(y int, x int) bool {
@@ -431,13 +479,13 @@ func (w *TcellWindow) Move(y int, x int) {
 func (w *TcellWindow) MoveAndClear(y int, x int) {
 	w.Move(y, x)
 	for i := w.lastX; i < w.width; i++ {
-		_screen.SetContent(i+w.left, w.lastY+w.top, rune(' '), nil, ColNormal.style())
+		_screen.SetContent(i+w.left, w.lastY+w.top, rune(' '), nil, w.normal().style())
 	}
 	w.lastX = x
 }
 
 func (w *TcellWindow) Print(text string) {
-	w.printString(text, ColNormal, 0)
+	w.printString(text, w.normal(), 0)
 }
 
 func (w *TcellWindow) printString(text string, pair ColorPair, a Attr) {
@@ -446,6 +494,7 @@ func (w *TcellWindow) printString(text string, pair ColorPair, a Attr) {
 
 	var style tcell.Style
 	if w.color {
+		a = a.Merge(pair.Attr())
 		style = pair.style().
 			Reverse(a&Attr(tcell.AttrReverse) != 0).
 			Underline(a&Attr(tcell.AttrUnderline) != 0)
@@ -499,6 +548,7 @@ func (w *TcellWindow) fillString(text string, pair ColorPair, a Attr) FillReturn
 
 	var style tcell.Style
 	if w.color {
+		a = a.Merge(pair.Attr())
 		style = pair.style()
 	} else {
 		style = ColNormal.style()
@@ -541,15 +591,15 @@ func (w *TcellWindow) fillString(text string, pair ColorPair, a Attr) FillReturn
 }
 
 func (w *TcellWindow) Fill(str string) FillReturn {
-	return w.fillString(str, ColNormal, 0)
+	return w.fillString(str, w.normal(), 0)
 }
 
 func (w *TcellWindow) CFill(fg Color, bg Color, a Attr, str string) FillReturn {
 	if fg == colDefault {
-		fg = ColNormal.Fg()
+		fg = w.normal().Fg()
 	}
 	if bg == colDefault {
-		bg = ColNormal.Bg()
+		bg = w.normal().Bg()
 	}
 	return w.fillString(str, NewColorPair(fg, bg), a)
 }
@@ -561,10 +611,12 @@ func (w *TcellWindow) drawBorder(around bool) {
 	bot := top + w.height
 
 	var style tcell.Style
-	if w.color {
-		style = ColBorder.style()
-	} else {
+	if !w.color {
 		style = ColNormal.style()
+	} else if w.preview {
+		style = ColPreviewBorder.style()
+	} else {
+		style = ColBorder.style()
 	}
 
 	for x := left; x < right; x++ {
@@ -5,6 +5,9 @@ import (
 	"os"
 	"strconv"
 	"time"
+	"unicode"
+
+	"github.com/junegunn/fzf/src/util"
 )
 
 // Types of user action
@@ -46,11 +49,13 @@ const (
 	DoubleClick
 	LeftClick
 	RightClick
+	Paste
 
 	BTab
 	BSpace
 
 	Del
+	Insert
 	PgUp
 	PgDn
 
@@ -61,9 +66,6 @@ const (
 	Home
 	End
 
-	SLeft
-	SRight
-
 	F1
 	F2
 	F3
@@ -78,25 +80,77 @@ const (
 	F12
 
 	Change
+)
 
-	AltSpace
-	AltSlash
-	AltBS
+// Modifier is a set of modifier keys
+type Modifier int
 
-	Alt0
+const (
+	ModShift Modifier = 1 << iota
+	ModAlt
+	ModCtrl
 )
 
-const ( // Reset iota
-	AltA = Alt0 + 'a' - '0' + iota
-	AltB
-	AltC
-	AltD
-	AltE
-	AltF
-	AltZ     = AltA + 'z' - 'a'
-	CtrlAltA = AltZ + 1
-	CtrlAltM = CtrlAltA + 'm' - 'a'
-)
+// Key is a key on the keyboard with modifiers or a special event such as
+// mouse click. Char is only set when Type is Rune.
+type Key struct {
+	Type int
+	Char rune
+	Mod  Modifier
+}
+
+// KeyOf returns the key of the given type without modifiers
+func KeyOf(keyType int) Key {
+	return Key{keyType, 0, 0}
+}
+
+// RuneKey returns the key for the character with the modifiers
+func RuneKey(char rune, mod Modifier) Key {
+	return Key{Rune, char, mod}
+}
+
+// WithModifiers returns the key combined with the modifiers in the form the
+// renderers report it. CTRL-I and CTRL-M are not merged into TAB and ENTER
+// so that they can be told apart with the kitty keyboard protocol.
+func WithModifiers(key Key, mod Modifier) Key {
+	if key.Type == Rune && mod&ModCtrl > 0 {
+		if key.Char >= 'a' && key.Char <= 'z' && key.Char != 'i' && key.Char != 'm' {
+			key = KeyOf(CtrlA + int(key.Char-'a'))
+			mod &^= ModCtrl
+		} else if key.Char == ' ' {
+			key = KeyOf(CtrlSpace)
+			mod &^= ModCtrl
+		}
+	}
+	if key.Type == Rune && mod&ModShift > 0 && unicode.IsLetter(key.Char) {
+		key.Char = unicode.ToUpper(key.Char)
+		mod &^= ModShift
+	}
+	if key.Type == Tab && mod&ModShift > 0 {
+		key = KeyOf(BTab)
+		mod &^= ModShift
+	}
+	key.Mod |= mod
+	return key
+}
+
+// LegacyKey returns the key that legacy terminals report for CTRL-I, CTRL-M,
+// and CTRL-[, which are indistinguishable from TAB, ENTER, and ESC
+func LegacyKey(key Key) (Key, bool) {
+	if key.Type != Rune || key.Mod&ModCtrl == 0 {
+		return key, false
+	}
+	mod := key.Mod &^ ModCtrl
+	switch key.Char {
+	case 'i':
+		return Key{Tab, 0, mod}, true
+	case 'm':
+		return Key{CtrlM, 0, mod}, true
+	case '[':
+		return Key{ESC, 0, mod}, true
+	}
+	return key, false
+}
 
 const (
 	doubleClickDuration = 500 * time.Millisecond
@@ -133,9 +187,10 @@ const (
 )
 
 type ColorPair struct {
-	fg Color
-	bg Color
-	id int
+	fg   Color
+	bg   Color
+	attr Attr
+	id   int
 }
 
 func HexToColor(rrggbb string) Color {
@@ -145,8 +200,71 @@ func HexToColor(rrggbb string) Color {
 	return Color((1 << 24) + (r << 16) + (g << 8) + b)
 }
 
+// colorDepth is the number of colors the terminal supports. 24-bit colors are
+// converted to the nearest colors in the palette of the size.
+var colorDepth = 1 << 24
+
+// Colors of the 16-color palette of xterm
+var palette16 = [16][3]int{
+	{0x00, 0x00, 0x00}, {0xcd, 0x00, 0x00}, {0x00, 0xcd, 0x00}, {0xcd, 0xcd, 0x00},
+	{0x00, 0x00, 0xee}, {0xcd, 0x00, 0xcd}, {0x00, 0xcd, 0xcd}, {0xe5, 0xe5, 0xe5},
+	{0x7f, 0x7f, 0x7f}, {0xff, 0x00, 0x00}, {0x00, 0xff, 0x00}, {0xff, 0xff, 0x00},
+	{0x5c, 0x5c, 0xff}, {0xff, 0x00, 0xff}, {0x00, 0xff, 0xff}, {0xff, 0xff, 0xff}}
+
+// Levels of the RGB components of the 6x6x6 color cube of the 256-color palette
+var cubeLevels = [6]int{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+
+func colorDistance(r1, g1, b1, r2, g2, b2 int) int {
+	return (r1-r2)*(r1-r2) + (g1-g2)*(g1-g2) + (b1-b2)*(b1-b2)
+}
+
+// degrade returns the nearest color in the palette of the given size if the
+// color is a 24-bit color and the palette is smaller
+func (c Color) degrade(depth int) Color {
+	if !c.is24() || depth >= 1<<24 {
+		return c
+	}
+	r, g, b := int(c>>16)&0xff, int(c>>8)&0xff, int(c)&0xff
+	if depth < 256 {
+		nearest := 0
+		for idx, rgb := range palette16 {
+			if colorDistance(r, g, b, rgb[0], rgb[1], rgb[2]) <
+				colorDistance(r, g, b, palette16[nearest][0], palette16[nearest][1], palette16[nearest][2]) {
+				nearest = idx
+			}
+		}
+		return Color(nearest)
+	}
+
+	level := func(v int) int {
+		nearest := 0
+		for idx, l := range cubeLevels {
+			if (v-l)*(v-l) < (v-cubeLevels[nearest])*(v-cubeLevels[nearest]) {
+				nearest = idx
+			}
+		}
+		return nearest
+	}
+	ri, gi, bi := level(r), level(g), level(b)
+	cube := Color(16 + 36*ri + 6*gi + bi)
+	cubeDistance := colorDistance(r, g, b, cubeLevels[ri], cubeLevels[gi], cubeLevels[bi])
+
+	// Grayscale ramp from 232 (0x08) to 255 (0xee)
+	gray := util.Constrain(((r+g+b)/3-8+5)/10, 0, 23)
+	value := 8 + 10*gray
+	if colorDistance(r, g, b, value, value, value) < cubeDistance {
+		return Color(232 + gray)
+	}
+	return cube
+}
+
 func NewColorPair(fg Color, bg Color) ColorPair {
-	return ColorPair{fg, bg, -1}
+	return ColorPair{fg, bg, AttrRegular, -1}
+}
+
+// Attr returns the text attributes of the color pair
+func (p ColorPair) Attr() Attr {
+	return p.attr
 }
 
 func (p ColorPair) Fg() Color {
@@ -161,26 +279,56 @@ func (p ColorPair) is24() bool {
 	return p.fg.is24() || p.bg.is24()
 }
 
+// ColorAttr is a color with text attributes
+type ColorAttr struct {
+	Color Color
+	Attr  Attr
+}
+
+// NewColorAttr returns a ColorAttr with the color and the attributes undefined
+func NewColorAttr() ColorAttr {
+	return ColorAttr{colUndefined, AttrUndefined}
+}
+
 type ColorTheme struct {
-	Fg           Color
-	Bg           Color
-	DarkBg       Color
-	Prompt       Color
-	Match        Color
-	Current      Color
-	CurrentMatch Color
-	Spinner      Color
-	Info         Color
-	Cursor       Color
-	Selected     Color
-	Header       Color
-	Border       Color
+	Fg            ColorAttr
+	Bg            ColorAttr
+	DarkBg        ColorAttr
+	Prompt        ColorAttr
+	Query         ColorAttr
+	Disabled      ColorAttr
+	Match         ColorAttr
+	Current       ColorAttr
+	CurrentMatch  ColorAttr
+	Spinner       ColorAttr
+	Info          ColorAttr
+	Cursor        ColorAttr
+	Selected      ColorAttr
+	Gutter        ColorAttr
+	Header        ColorAttr
+	Border        ColorAttr
+	Separator     ColorAttr
+	Scrollbar     ColorAttr
+	PreviewFg     ColorAttr
+	PreviewBg     ColorAttr
+	PreviewBorder ColorAttr
+	Error         ColorAttr
 }
 
 type Event struct {
 	Type       int
 	Char       rune
+	Mod        Modifier
 	MouseEvent *MouseEvent
+	Text       string // Pasted text
+}
+
+// Key returns the key of the event
+func (e Event) Key() Key {
+	if e.Type == Rune {
+		return Key{e.Type, e.Char, e.Mod}
+	}
+	return Key{e.Type, 0, e.Mod}
 }
 
 type MouseEvent struct {
@@ -191,6 +339,7 @@ type MouseEvent struct {
 	Down   bool
 	Double bool
 	Mod    bool
+	Drag   bool
 }
 
 type BorderStyle int
@@ -211,12 +360,13 @@ type Renderer interface {
 	Close()
 
 	GetChar() Event
+	GetCharTimeout(timeout time.Duration) (Event, bool)
 
 	MaxX() int
 	MaxY() int
 	DoesAutoWrap() bool
 
-	NewWindow(top int, left int, width int, height int, borderStyle BorderStyle) Window
+	NewWindow(top int, left int, width int, height int, preview bool, borderStyle BorderStyle) Window
 }
 
 type Window interface {
@@ -248,6 +398,8 @@ type FullscreenRenderer struct {
 	forceBlack   bool
 	prevDownTime time.Time
 	clickY       []int
+	leftDown     bool
+	timeouts     int
 }
 
 func NewFullscreenRenderer(theme *ColorTheme, forceBlack bool, mouse bool) Renderer {
@@ -265,34 +417,51 @@ var (
 	Dark256   *ColorTheme
 	Light256  *ColorTheme
 
-	ColNormal       ColorPair
-	ColPrompt       ColorPair
-	ColMatch        ColorPair
-	ColCurrent      ColorPair
-	ColCurrentMatch ColorPair
-	ColSpinner      ColorPair
-	ColInfo         ColorPair
-	ColCursor       ColorPair
-	ColSelected     ColorPair
-	ColHeader       ColorPair
-	ColBorder       ColorPair
+	ColNormal        ColorPair
+	ColPrompt        ColorPair
+	ColQuery         ColorPair
+	ColDisabled      ColorPair
+	ColMatch         ColorPair
+	ColCurrent       ColorPair
+	ColCurrentMatch  ColorPair
+	ColSpinner       ColorPair
+	ColInfo          ColorPair
+	ColCursor        ColorPair
+	ColSelected      ColorPair
+	ColGutter        ColorPair
+	ColHeader        ColorPair
+	ColBorder        ColorPair
+	ColSeparator     ColorPair
+	ColScrollbar     ColorPair
+	ColPreview       ColorPair
+	ColPreviewBorder ColorPair
+	ColError         ColorPair
 )
 
 func EmptyTheme() *ColorTheme {
 	return &ColorTheme{
-		Fg:           colUndefined,
-		Bg:           colUndefined,
-		DarkBg:       colUndefined,
-		Prompt:       colUndefined,
-		Match:        colUndefined,
-		Current:      colUndefined,
-		CurrentMatch: colUndefined,
-		Spinner:      colUndefined,
-		Info:         colUndefined,
-		Cursor:       colUndefined,
-		Selected:     colUndefined,
-		Header:       colUndefined,
-		Border:       colUndefined}
+		Fg:            NewColorAttr(),
+		Bg:            NewColorAttr(),
+		DarkBg:        NewColorAttr(),
+		Prompt:        NewColorAttr(),
+		Query:         NewColorAttr(),
+		Disabled:      NewColorAttr(),
+		Match:         NewColorAttr(),
+		Current:       NewColorAttr(),
+		CurrentMatch:  NewColorAttr(),
+		Spinner:       NewColorAttr(),
+		Info:          NewColorAttr(),
+		Cursor:        NewColorAttr(),
+		Selected:      NewColorAttr(),
+		Gutter:        NewColorAttr(),
+		Header:        NewColorAttr(),
+		Border:        NewColorAttr(),
+		Separator:     NewColorAttr(),
+		Scrollbar:     NewColorAttr(),
+		PreviewFg:     NewColorAttr(),
+		PreviewBg:     NewColorAttr(),
+		PreviewBorder: NewColorAttr(),
+		Error:         NewColorAttr()}
 }
 
 func errorExit(message string) {
@@ -301,48 +470,80 @@ func errorExit(message string) {
 }
 
 func init() {
+	c := func(color Color) ColorAttr {
+		return ColorAttr{color, AttrRegular}
+	}
+	// The newer slots are undefined so that they follow the related ones
+	undefined := NewColorAttr()
 	Default16 = &ColorTheme{
-		Fg:           colDefault,
-		Bg:           colDefault,
-		DarkBg:       colBlack,
-		Prompt:       colBlue,
-		Match:        colGreen,
-		Current:      colYellow,
-		CurrentMatch: colGreen,
-		Spinner:      colGreen,
-		Info:         colWhite,
-		Cursor:       colRed,
-		Selected:     colMagenta,
-		Header:       colCyan,
-		Border:       colBlack}
+		Fg:            c(colDefault),
+		Bg:            c(colDefault),
+		DarkBg:        c(colBlack),
+		Prompt:        c(colBlue),
+		Query:         undefined,
+		Disabled:      undefined,
+		Match:         c(colGreen),
+		Current:       c(colYellow),
+		CurrentMatch:  c(colGreen),
+		Spinner:       c(colGreen),
+		Info:          c(colWhite),
+		Cursor:        c(colRed),
+		Selected:      c(colMagenta),
+		Gutter:        undefined,
+		Header:        c(colCyan),
+		Border:        c(colBlack),
+		Separator:     undefined,
+		Scrollbar:     c(colWhite),
+		PreviewFg:     undefined,
+		PreviewBg:     undefined,
+		PreviewBorder: undefined,
+		Error:         c(colRed)}
 	Dark256 = &ColorTheme{
-		Fg:           colDefault,
-		Bg:           colDefault,
-		DarkBg:       236,
-		Prompt:       110,
-		Match:        108,
-		Current:      254,
-		CurrentMatch: 151,
-		Spinner:      148,
-		Info:         144,
-		Cursor:       161,
-		Selected:     168,
-		Header:       109,
-		Border:       59}
+		Fg:            c(colDefault),
+		Bg:            c(colDefault),
+		DarkBg:        c(236),
+		Prompt:        c(110),
+		Query:         undefined,
+		Disabled:      undefined,
+		Match:         c(108),
+		Current:       c(254),
+		CurrentMatch:  c(151),
+		Spinner:       c(148),
+		Info:          c(144),
+		Cursor:        c(161),
+		Selected:      c(168),
+		Gutter:        undefined,
+		Header:        c(109),
+		Border:        c(59),
+		Separator:     undefined,
+		Scrollbar:     c(59),
+		PreviewFg:     undefined,
+		PreviewBg:     undefined,
+		PreviewBorder: undefined,
+		Error:         c(167)}
 	Light256 = &ColorTheme{
-		Fg:           colDefault,
-		Bg:           colDefault,
-		DarkBg:       251,
-		Prompt:       25,
-		Match:        66,
-		Current:      237,
-		CurrentMatch: 23,
-		Spinner:      65,
-		Info:         101,
-		Cursor:       161,
-		Selected:     168,
-		Header:       31,
-		Border:       145}
+		Fg:            c(colDefault),
+		Bg:            c(colDefault),
+		DarkBg:        c(251),
+		Prompt:        c(25),
+		Query:         undefined,
+		Disabled:      undefined,
+		Match:         c(66),
+		Current:       c(237),
+		CurrentMatch:  c(23),
+		Spinner:       c(65),
+		Info:          c(101),
+		Cursor:        c(161),
+		Selected:      c(168),
+		Gutter:        undefined,
+		Header:        c(31),
+		Border:        c(145),
+		Separator:     undefined,
+		Scrollbar:     c(145),
+		PreviewFg:     undefined,
+		PreviewBg:     undefined,
+		PreviewBorder: undefined,
+		Error:         c(124)}
 }
 
 func initTheme(theme *ColorTheme, baseTheme *ColorTheme, forceBlack bool) {
@@ -352,14 +553,18 @@ func initTheme(theme *ColorTheme, baseTheme *ColorTheme, forceBlack bool) {
 	}
 
 	if forceBlack {
-		theme.Bg = colBlack
+		theme.Bg.Color = colBlack
 	}
 
-	o := func(a Color, b Color) Color {
-		if b == colUndefined {
-			return a
+	o := func(a ColorAttr, b ColorAttr) ColorAttr {
+		c := a
+		if b.Color != colUndefined {
+			c.Color = b.Color
+		}
+		if b.Attr != AttrUndefined {
+			c.Attr = b.Attr
 		}
-		return b
+		return c
 	}
 	theme.Fg = o(baseTheme.Fg, theme.Fg)
 	theme.Bg = o(baseTheme.Bg, theme.Bg)
@@ -374,41 +579,72 @@ func initTheme(theme *ColorTheme, baseTheme *ColorTheme, forceBlack bool) {
 	theme.Selected = o(baseTheme.Selected, theme.Selected)
 	theme.Header = o(baseTheme.Header, theme.Header)
 	theme.Border = o(baseTheme.Border, theme.Border)
-
+	theme.Scrollbar = o(baseTheme.Scrollbar, theme.Scrollbar)
+	theme.Error = o(baseTheme.Error, theme.Error)
+
+	// The newer slots default to the related ones
+	theme.Query = o(theme.Fg, o(baseTheme.Query, theme.Query))
+	theme.Disabled = o(theme.Query, o(baseTheme.Disabled, theme.Disabled))
+	theme.Gutter = o(theme.DarkBg, o(baseTheme.Gutter, theme.Gutter))
+	theme.Separator = o(theme.Border, o(baseTheme.Separator, theme.Separator))
+	theme.PreviewFg = o(theme.Fg, o(baseTheme.PreviewFg, theme.PreviewFg))
+	theme.PreviewBg = o(theme.Bg, o(baseTheme.PreviewBg, theme.PreviewBg))
+	theme.PreviewBorder = o(theme.Border, o(baseTheme.PreviewBorder, theme.PreviewBorder))
+
+	colorDepth = detectColorDepth(baseTheme)
 	initPalette(theme)
 }
 
+// detectColorDepth returns the number of colors the terminal supports
+func detectColorDepth(baseTheme *ColorTheme) int {
+	switch os.Getenv("COLORTERM") {
+	case "truecolor", "24bit":
+		return 1 << 24
+	}
+	if baseTheme == Default16 {
+		return 16
+	}
+	return 256
+}
+
 func initPalette(theme *ColorTheme) {
 	idx := 0
-	pair := func(fg, bg Color) ColorPair {
+	pair := func(fg, bg ColorAttr) ColorPair {
 		idx++
-		return ColorPair{fg, bg, idx}
+		// Attributes of the background colors are ignored
+		return ColorPair{fg.Color, bg.Color, fg.Attr, idx}
 	}
-	if theme != nil {
-		ColNormal = pair(theme.Fg, theme.Bg)
-		ColPrompt = pair(theme.Prompt, theme.Bg)
-		ColMatch = pair(theme.Match, theme.Bg)
-		ColCurrent = pair(theme.Current, theme.DarkBg)
-		ColCurrentMatch = pair(theme.CurrentMatch, theme.DarkBg)
-		ColSpinner = pair(theme.Spinner, theme.Bg)
-		ColInfo = pair(theme.Info, theme.Bg)
-		ColCursor = pair(theme.Cursor, theme.DarkBg)
-		ColSelected = pair(theme.Selected, theme.DarkBg)
-		ColHeader = pair(theme.Header, theme.Bg)
-		ColBorder = pair(theme.Border, theme.Bg)
-	} else {
-		ColNormal = pair(colDefault, colDefault)
-		ColPrompt = pair(colDefault, colDefault)
-		ColMatch = pair(colDefault, colDefault)
-		ColCurrent = pair(colDefault, colDefault)
-		ColCurrentMatch = pair(colDefault, colDefault)
-		ColSpinner = pair(colDefault, colDefault)
-		ColInfo = pair(colDefault, colDefault)
-		ColCursor = pair(colDefault, colDefault)
-		ColSelected = pair(colDefault, colDefault)
-		ColHeader = pair(colDefault, colDefault)
-		ColBorder = pair(colDefault, colDefault)
+	if theme == nil {
+		theme = EmptyTheme()
+		for _, ptr := range []*ColorAttr{
+			&theme.Fg, &theme.Bg, &theme.DarkBg, &theme.Prompt, &theme.Query,
+			&theme.Disabled, &theme.Match, &theme.Current, &theme.CurrentMatch,
+			&theme.Spinner, &theme.Info, &theme.Cursor, &theme.Selected,
+			&theme.Gutter, &theme.Header, &theme.Border, &theme.Separator,
+			&theme.Scrollbar, &theme.PreviewFg, &theme.PreviewBg, &theme.PreviewBorder,
+			&theme.Error} {
+			*ptr = ColorAttr{colDefault, AttrRegular}
+		}
 	}
+	ColNormal = pair(theme.Fg, theme.Bg)
+	ColPrompt = pair(theme.Prompt, theme.Bg)
+	ColQuery = pair(theme.Query, theme.Bg)
+	ColDisabled = pair(theme.Disabled, theme.Bg)
+	ColMatch = pair(theme.Match, theme.Bg)
+	ColCurrent = pair(theme.Current, theme.DarkBg)
+	ColCurrentMatch = pair(theme.CurrentMatch, theme.DarkBg)
+	ColSpinner = pair(theme.Spinner, theme.Bg)
+	ColInfo = pair(theme.Info, theme.Bg)
+	ColCursor = pair(theme.Cursor, theme.DarkBg)
+	ColSelected = pair(theme.Selected, theme.DarkBg)
+	ColGutter = pair(theme.Cursor, theme.Gutter)
+	ColHeader = pair(theme.Header, theme.Bg)
+	ColBorder = pair(theme.Border, theme.Bg)
+	ColSeparator = pair(theme.Separator, theme.Bg)
+	ColScrollbar = pair(theme.Scrollbar, theme.Bg)
+	ColPreview = pair(theme.PreviewFg, theme.PreviewBg)
+	ColPreviewBorder = pair(theme.PreviewBorder, theme.PreviewBg)
+	ColError = pair(theme.Error, theme.Bg)
 }
 
 func attrFor(color ColorPair, attr Attr) Attr {
@@ -18,3 +18,23 @@ func TestHexToColor(t *testing.T) {
 	assert("#102030", 16, 32, 48)
 	assert("#ffffff", 255, 255, 255)
 }
+
+func TestDegradeColor(t *testing.T) {
+	assert := func(expr string, depth int, expected Color) {
+		if color := HexToColor(expr).degrade(depth); color != expected {
+			t.Errorf("%s (%d): expected %d, got %d", expr, depth, expected, color)
+		}
+	}
+
+	assert("#ff0000", 1<<24, HexToColor("#ff0000"))
+	assert("#ff0000", 256, 196)
+	assert("#808080", 256, 244)
+	assert("#000000", 256, 16)
+	assert("#ff0000", 16, 9)
+	assert("#cd0000", 16, 1)
+	assert("#808080", 16, 8)
+
+	if color := Color(42).degrade(16); color != 42 {
+		t.Errorf("palette colors should not be degraded: %d", color)
+	}
+}
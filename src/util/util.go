@@ -3,6 +3,8 @@ package util
 import (
 	"math"
 	"os"
+	"os/exec"
+	"syscall"
 	"time"
 
 	"github.com/mattn/go-isatty"
@@ -111,3 +113,17 @@ func DurWithin(
 func IsTty() bool {
 	return isatty.IsTerminal(os.Stdin.Fd())
 }
+
+// ExitStatus returns the exit status of the command from the error returned
+// by Run. -1 is returned if the command could not be run or was killed.
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+	return -1
+}
@@ -1,6 +1,9 @@
 package util
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestMax(t *testing.T) {
 	if Max(-2, 5) != 5 {
@@ -20,3 +23,15 @@ func TestContrain(t *testing.T) {
 		t.Error("Expected", 3)
 	}
 }
+
+func TestExitStatus(t *testing.T) {
+	if status := ExitStatus(ExecCommand("exit 3").Run()); status != 3 {
+		t.Errorf("Expected 3, actual: %d", status)
+	}
+	if status := ExitStatus(ExecCommand("exit 0").Run()); status != 0 {
+		t.Errorf("Expected 0, actual: %d", status)
+	}
+	if status := ExitStatus(errors.New("not started")); status != -1 {
+		t.Errorf("Expected -1, actual: %d", status)
+	}
+}
@@ -0,0 +1,376 @@
+package fzf
+
+import (
+	"unicode"
+
+	"github.com/junegunn/fzf/src/tui"
+	"github.com/junegunn/fzf/src/util"
+)
+
+type viMode int
+
+const (
+	viInsert viMode = iota
+	viNormal
+)
+
+var viIndicators = map[viMode]string{
+	viInsert: "[I] ",
+	viNormal: "[N] "}
+
+// viState holds the state of the modal query editor enabled by --keymap=vi
+type viState struct {
+	mode     viMode
+	count    int
+	opCount  int
+	operator rune
+	argument rune
+	// Edits in the same insert session are undone together
+	grouped bool
+}
+
+func (vi *viState) reset() {
+	vi.count = 0
+	vi.opCount = 0
+	vi.operator = 0
+	vi.argument = 0
+}
+
+// repeat returns the number of times the current command should be repeated
+func (vi *viState) repeat() int {
+	return util.Max(vi.count, 1) * util.Max(vi.opCount, 1)
+}
+
+func viCharClass(r rune) int {
+	if unicode.IsSpace(r) {
+		return 0
+	}
+	if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+		return 2
+	}
+	return 1
+}
+
+// viNextWord returns the position of the beginning of the next word
+func viNextWord(input []rune, pos int) int {
+	if pos >= len(input) {
+		return len(input)
+	}
+	if class := viCharClass(input[pos]); class > 0 {
+		for pos < len(input) && viCharClass(input[pos]) == class {
+			pos++
+		}
+	}
+	for pos < len(input) && viCharClass(input[pos]) == 0 {
+		pos++
+	}
+	return pos
+}
+
+// viPrevWord returns the position of the beginning of the previous word
+func viPrevWord(input []rune, pos int) int {
+	for pos > 0 && viCharClass(input[pos-1]) == 0 {
+		pos--
+	}
+	if pos > 0 {
+		class := viCharClass(input[pos-1])
+		for pos > 0 && viCharClass(input[pos-1]) == class {
+			pos--
+		}
+	}
+	return pos
+}
+
+// viWordEnd returns the position of the end of the current or the next word.
+// If stay is true and the cursor is already on a word, the end of the word is
+// returned even if the cursor is at the end of it.
+func viWordEnd(input []rune, pos int, stay bool) int {
+	if !stay || pos >= len(input) || viCharClass(input[pos]) == 0 {
+		pos++
+		for pos < len(input) && viCharClass(input[pos]) == 0 {
+			pos++
+		}
+	}
+	if pos >= len(input) {
+		return len(input) - 1
+	}
+	class := viCharClass(input[pos])
+	for pos+1 < len(input) && viCharClass(input[pos+1]) == class {
+		pos++
+	}
+	return pos
+}
+
+// viFind finds the n-th occurrence of the character for f, F, t, and T
+func viFind(input []rune, pos int, cmd rune, char rune, n int) (int, bool) {
+	forward := cmd == 'f' || cmd == 't'
+	found := -1
+	for idx := pos; n > 0; {
+		if forward {
+			idx++
+		} else {
+			idx--
+		}
+		if idx < 0 || idx >= len(input) {
+			break
+		}
+		if input[idx] == char {
+			found = idx
+			n--
+		}
+	}
+	if n > 0 {
+		return pos, false
+	}
+	switch cmd {
+	case 't':
+		found--
+	case 'T':
+		found++
+	}
+	return found, true
+}
+
+// viMotion returns the target position of the motion command and whether the
+// motion is inclusive
+func (t *Terminal) viMotion(cmd rune, n int) (int, bool, bool) {
+	input := t.input
+	pos := t.cx
+	switch cmd {
+	case 'h':
+		return util.Max(pos-n, 0), false, true
+	case 'l', ' ':
+		return util.Min(pos+n, len(input)), false, true
+	case '0':
+		return 0, false, true
+	case '^':
+		pos = 0
+		for pos < len(input) && viCharClass(input[pos]) == 0 {
+			pos++
+		}
+		return pos, false, true
+	case '$':
+		return len(input) - 1, true, len(input) > 0
+	case 'w':
+		if t.vi.operator == 'c' && pos < len(input) && viCharClass(input[pos]) > 0 {
+			// cw behaves like ce
+			for i := 0; i < n; i++ {
+				pos = viWordEnd(input, pos, i == 0)
+			}
+			return pos, true, len(input) > 0
+		}
+		for i := 0; i < n; i++ {
+			pos = viNextWord(input, pos)
+		}
+		return pos, false, true
+	case 'b':
+		for i := 0; i < n; i++ {
+			pos = viPrevWord(input, pos)
+		}
+		return pos, false, true
+	case 'e':
+		for i := 0; i < n; i++ {
+			pos = viWordEnd(input, pos, false)
+		}
+		return pos, true, len(input) > 0
+	}
+	return pos, false, false
+}
+
+func (t *Terminal) setViMode(mode viMode) {
+	t.vi.mode = mode
+	t.vi.grouped = false
+	t.vi.reset()
+	t.updatePrompt()
+}
+
+// viConstrainCursor keeps the cursor on a character in normal mode
+func (t *Terminal) viConstrainCursor() {
+	if t.vi != nil && t.vi.mode == viNormal {
+		t.cx = util.Constrain(t.cx, 0, util.Max(len(t.input)-1, 0))
+	}
+}
+
+// viOperate applies the pending operator to the range of the query
+func (t *Terminal) viOperate(op rune, from int, to int) {
+	from = util.Constrain(from, 0, len(t.input))
+	to = util.Constrain(to, from, len(t.input))
+	t.kill(t.input[from:to])
+	switch op {
+	case 'd', 'c':
+		t.input = append(copySlice(t.input[:from]), t.input[to:]...)
+		t.cx = from
+		if op == 'c' {
+			t.setViMode(viInsert)
+		}
+	case 'y':
+		t.cx = from
+	}
+}
+
+// viPut inserts the yanked text n times after or before the cursor
+func (t *Terminal) viPut(after bool, n int) {
+	yanked := t.lastKill()
+	if len(yanked) == 0 {
+		return
+	}
+	pos := t.cx
+	if after && len(t.input) > 0 {
+		pos++
+	}
+	text := []rune{}
+	for i := 0; i < n; i++ {
+		text = append(text, yanked...)
+	}
+	t.input = append(append(copySlice(t.input[:pos]), text...), t.input[pos:]...)
+	t.cx = pos + len(text) - 1
+}
+
+// viKey processes the key event in vi mode. Returns the actions to perform
+// and true if the event is handled by the editor. Unhandled events are
+// processed with the regular key bindings.
+func (t *Terminal) viKey(event tui.Event) ([]action, bool) {
+	vi := t.vi
+	key := event.Key()
+	if vi.mode == viInsert {
+		if key == tui.KeyOf(tui.ESC) {
+			t.setViMode(viNormal)
+			if t.cx > 0 {
+				t.cx--
+			}
+			return nil, true
+		}
+		return nil, false
+	}
+
+	if key.Type != tui.Rune || key.Mod != 0 {
+		busy := vi.count > 0 || vi.operator != 0 || vi.argument != 0
+		vi.reset()
+		switch key {
+		case tui.KeyOf(tui.ESC):
+			return nil, busy
+		case tui.KeyOf(tui.CtrlR):
+			return toActions(actRedo), true
+		}
+		return nil, false
+	}
+
+	char := event.Char
+	if vi.argument != 0 {
+		cmd := vi.argument
+		vi.argument = 0
+		if cmd == 'r' {
+			n := vi.repeat()
+			if t.cx+n <= len(t.input) {
+				input := copySlice(t.input)
+				for i := t.cx; i < t.cx+n; i++ {
+					input[i] = char
+				}
+				t.input = input
+				t.cx += n - 1
+			}
+			vi.reset()
+			return nil, true
+		}
+		pos, ok := viFind(t.input, t.cx, cmd, char, vi.repeat())
+		t.viMove(pos, cmd == 'f' || cmd == 't', ok)
+		return nil, true
+	}
+
+	if char >= '1' && char <= '9' || char == '0' && vi.count > 0 {
+		vi.count = vi.count*10 + int(char-'0')
+		return nil, true
+	}
+
+	n := vi.repeat()
+	switch char {
+	case 'f', 'F', 't', 'T', 'r':
+		vi.argument = char
+		return nil, true
+	case 'd', 'c', 'y':
+		if vi.operator == 0 {
+			vi.operator = char
+			vi.opCount = vi.count
+			vi.count = 0
+			return nil, true
+		}
+		if vi.operator == char {
+			// dd, cc, and yy operate on the whole query
+			t.viOperate(char, 0, len(t.input))
+		}
+		vi.reset()
+		return nil, true
+	}
+
+	if pos, inclusive, ok := t.viMotion(char, n); ok {
+		t.viMove(pos, inclusive, ok)
+		return nil, true
+	}
+
+	// Commands that cannot be combined with an operator
+	defer vi.reset()
+	if vi.operator != 0 {
+		return nil, true
+	}
+	switch char {
+	case 'i':
+		t.setViMode(viInsert)
+	case 'a':
+		t.cx = util.Min(t.cx+1, len(t.input))
+		t.setViMode(viInsert)
+	case 'I':
+		t.cx = 0
+		t.setViMode(viInsert)
+	case 'A':
+		t.cx = len(t.input)
+		t.setViMode(viInsert)
+	case 'x':
+		t.viOperate('d', t.cx, t.cx+n)
+	case 'X':
+		t.viOperate('d', t.cx-n, t.cx)
+	case 's':
+		t.viOperate('c', t.cx, t.cx+n)
+	case 'S':
+		t.viOperate('c', 0, len(t.input))
+	case 'D':
+		t.viOperate('d', t.cx, len(t.input))
+	case 'C':
+		t.viOperate('c', t.cx, len(t.input))
+	case 'p', 'P':
+		t.viPut(char == 'p', n)
+	case 'u':
+		return repeatActions(actUndo, n), true
+	case 'j':
+		return repeatActions(actDown, n), true
+	case 'k':
+		return repeatActions(actUp, n), true
+	}
+	return nil, true
+}
+
+// viMove moves the cursor to the target position of the motion, or applies
+// the pending operator to the range between the cursor and the position
+func (t *Terminal) viMove(pos int, inclusive bool, ok bool) {
+	op := t.vi.operator
+	t.vi.reset()
+	if !ok {
+		return
+	}
+	if op == 0 {
+		t.cx = pos
+		return
+	}
+	from, to := util.Min(t.cx, pos), util.Max(t.cx, pos)
+	if inclusive {
+		to++
+	}
+	t.viOperate(op, from, to)
+}
+
+func repeatActions(actionType actionType, n int) []action {
+	actions := make([]action, n)
+	for i := range actions {
+		actions[i] = action{t: actionType}
+	}
+	return actions
+}
@@ -0,0 +1,116 @@
+package fzf
+
+import (
+	"testing"
+
+	"github.com/junegunn/fzf/src/tui"
+)
+
+func TestViWordMotions(t *testing.T) {
+	input := []rune("foo bar-baz  qux")
+	if pos := viNextWord(input, 0); pos != 4 {
+		t.Errorf("w: %d", pos)
+	}
+	if pos := viNextWord(input, 4); pos != 7 {
+		t.Errorf("w: %d", pos)
+	}
+	if pos := viNextWord(input, 8); pos != 13 {
+		t.Errorf("w: %d", pos)
+	}
+	if pos := viNextWord(input, 14); pos != 16 {
+		t.Errorf("w: %d", pos)
+	}
+	if pos := viPrevWord(input, 13); pos != 8 {
+		t.Errorf("b: %d", pos)
+	}
+	if pos := viPrevWord(input, 8); pos != 7 {
+		t.Errorf("b: %d", pos)
+	}
+	if pos := viWordEnd(input, 0, false); pos != 2 {
+		t.Errorf("e: %d", pos)
+	}
+	if pos := viWordEnd(input, 2, false); pos != 6 {
+		t.Errorf("e: %d", pos)
+	}
+	if pos := viWordEnd(input, 2, true); pos != 2 {
+		t.Errorf("e: %d", pos)
+	}
+	if pos, ok := viFind(input, 0, 'f', 'a', 2); !ok || pos != 9 {
+		t.Errorf("f: %d", pos)
+	}
+	if pos, ok := viFind(input, 9, 'T', 'o', 1); !ok || pos != 3 {
+		t.Errorf("T: %d", pos)
+	}
+	if _, ok := viFind(input, 0, 't', 'z', 2); ok {
+		t.Error("t should fail")
+	}
+}
+
+func TestViEditing(t *testing.T) {
+	term := &Terminal{
+		promptText: "> ",
+		keymap:     defaultKeymap(),
+		vi:         &viState{mode: viInsert},
+		input:      []rune("foo bar baz"),
+		killRing:   [][]rune{},
+		undoStack:  []editState{},
+		redoStack:  []editState{}}
+	term.cx = len(term.input)
+
+	// Processes the keys as the Loop does, ignoring the actions other than
+	// the ones for editing the query
+	feed := func(keys string) []action {
+		var actions []action
+		for _, r := range keys {
+			event := tui.Event{Type: tui.Rune, Char: r}
+			switch r {
+			case 0x1b:
+				event = tui.Event{Type: tui.ESC}
+			case 0x12:
+				event = tui.Event{Type: tui.CtrlR}
+			}
+			edit := term.beginEdit()
+			actions = term.keyActions(event)
+			for _, action := range actions {
+				term.editQuery(action, event, edit)
+			}
+			term.endEdit(edit)
+		}
+		return actions
+	}
+	check := func(input string, cx int, mode viMode) {
+		if string(term.input) != input || term.cx != cx || term.vi.mode != mode {
+			t.Errorf("expected %q at %d (%d), got %q at %d (%d)",
+				input, cx, mode, string(term.input), term.cx, term.vi.mode)
+		}
+	}
+
+	feed("\x1b")
+	check("foo bar baz", 10, viNormal)
+	if term.prompt != "[N] > " || term.promptLen != 6 {
+		t.Errorf("invalid prompt: %q", term.prompt)
+	}
+	feed("0dw")
+	check("bar baz", 0, viNormal)
+	feed("2x")
+	check("r baz", 0, viNormal)
+	feed("$p")
+	check("r bazba", 6, viNormal)
+	feed("0cwqux\x1b")
+	check("qux bazba", 2, viNormal)
+	feed("u")
+	check("r bazba", 0, viNormal)
+	feed("2u")
+	check("bar baz", 0, viNormal)
+	feed("\x12")
+	check("r baz", 4, viNormal)
+	feed("Fbrx")
+	check("r xaz", 2, viNormal)
+	feed("d0")
+	check("xaz", 0, viNormal)
+	feed("yyP")
+	check("xazxaz", 2, viNormal)
+	if actions := feed("3j"); len(actions) != 3 || actions[0].t != actDown {
+		t.Errorf("invalid actions: %v", actions)
+	}
+}